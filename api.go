@@ -1,18 +1,17 @@
 package spay
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"strconv"
 	"time"
 
-	gonanoid "github.com/matoous/go-nanoid/v2"
 	"github.com/samber/lo"
-	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -27,8 +26,94 @@ const (
 
 var (
 	ErrInvalidArgument = fmt.Errorf("invalid argument provided")
+	// ErrTransferNotCompleted wraps a transfer Spay answered with a
+	// response code other than success.
+	ErrTransferNotCompleted = errors.New("could not complete transfer")
 )
 
+// IsRejected reports whether err from a transfer method means the transfer
+// definitely did not go through: Spay refused it with a 4xx response and a
+// response code, answered with a final failure code, or it was never sent.
+// Any other error, 5xx responses and pending NIP codes included, leaves the
+// outcome unknown and calls for a requery.
+func IsRejected(err error) bool {
+	var opErr *OperationError
+	if errors.As(err, &opErr) && opErr.HttpStatus >= 500 {
+		return false
+	}
+	if errors.Is(err, ErrTransferNotCompleted) {
+		return opErr != nil && !IsPendingCode(opErr.Code)
+	}
+	var apiErr *ApiResponseErrorResult
+	var dryRun *DryRunError
+	return (errors.As(err, &apiErr) && apiErr.Response != "") ||
+		errors.As(err, &dryRun) ||
+		errors.Is(err, ErrInvalidArgument) ||
+		errors.Is(err, ErrLimitExceeded) ||
+		errors.Is(err, ErrInvalidApproval) ||
+		errors.Is(err, ErrRateLimitWait) ||
+		errors.Is(err, ErrCircuitOpen) ||
+		errors.Is(err, ErrFundsCheck)
+}
+
+// pendingCodes are the NIP response codes NIBSS asks to be requeried
+// rather than treated as failures: status unknown, still processing,
+// system malfunction and timeout. An empty code says nothing either.
+var pendingCodes = map[string]bool{"": true, "01": true, "09": true, "96": true, "97": true}
+
+// IsPendingCode reports whether a transfer answered with code may still
+// complete, so its outcome has to be settled by a requery.
+func IsPendingCode(code string) bool {
+	return pendingCodes[code]
+}
+
+// operation describes one Spay or requery endpoint.
+type operation struct {
+	name        string
+	path        string
+	requestType int
+	decrypt     decryptPolicy
+}
+
+var (
+	opInterBankTransfer       = operation{name: OpInterBankTransfer, path: "/api/Spay/InterbankTransferReq", requestType: 160}
+	opListBanks               = operation{name: OpListBanks, path: "/api/Spay/GetBankListReq", requestType: 152}
+	opGetStatement            = operation{name: OpGetStatement, path: "/api/Spay/GetStatement", requestType: 153}
+	opBalanceEnquiry          = operation{name: OpBalanceEnquiry, path: "/api/Spay/BalanceEnquiry", requestType: 151}
+	opSterlingTransfer        = operation{name: OpSterlingTransfer, path: "/api/Spay/SBPT24txnRequest", requestType: 110}
+	opSterlingNameEnquiry     = operation{name: OpSterlingNameEnquiry, path: "/api/Spay/SBPNameEnquiry", requestType: 219}
+	opOtherBanksNameEnquiry   = operation{name: OpOtherBanksNameEnquiry, path: "/api/Spay/InterbankNameEnquiry", requestType: 161}
+	opListInflowsForToday     = operation{name: OpListInflowsForToday}
+	opListInflowsForAccount   = operation{name: OpListInflowsForAccount}
+	opQueryInflowsBySessionID = operation{name: OpQueryInflowsBySessionID}
+	opListInflows             = operation{name: OpListInflows}
+)
+
+// DryRunError is returned instead of sending a request when the Api was
+// built WithDryRun. Body is exactly what would have been sent; for Spay
+// operations it is the base64 3DES ciphertext and Encrypted is true.
+type DryRunError struct {
+	Method    string
+	Url       string
+	Body      []byte
+	Encrypted bool
+}
+
+func (d *DryRunError) Error() string {
+	return fmt.Sprintf("dry run: %s %s not sent", d.Method, d.Url)
+}
+
+// Option configures optional behaviour of an Api.
+type Option func(*Api)
+
+// WithDryRun makes every network method return a *DryRunError describing
+// the request instead of sending it.
+func WithDryRun() Option {
+	return func(a *Api) {
+		a.dryRun = true
+	}
+}
+
 type BitString string
 
 func (b BitString) AsByteSlice() ([]byte, error) {
@@ -63,6 +148,19 @@ type Api struct {
 	httpClient            *http.Client
 	tellerId              string
 	shouldDecryptResponse bool
+	dryRun                bool
+	metrics               Metrics
+	tracer                trace.Tracer
+	audit                 AuditSink
+	limits                *limiter
+	interceptors          []Interceptor
+	handler               Handler
+	feeSchedules          []FeeSchedule
+	funds                 *fundsChecker
+	references            ReferenceGenerator
+	referenceFormat       ReferenceFormat
+	throttles             map[string]*throttle
+	breakers              map[string]*breaker
 }
 
 func NewApi(
@@ -72,6 +170,7 @@ func NewApi(
 	fromAccount string,
 	shouldDecryptResponse bool,
 	baseUrl string,
+	opts ...Option,
 ) (*Api, error) {
 
 	if baseUrl == "" {
@@ -86,24 +185,48 @@ func NewApi(
 	config.FromAccount = fromAccount
 	config.transferCost = 10.0
 
-	httpClient := &http.Client{}
-	return &Api{
+	api := &Api{
 		config:                config,
-		httpClient:            httpClient,
+		httpClient:            newHttpClient(DefaultTransportConfig()),
 		tellerId:              tellerId,
 		shouldDecryptResponse: shouldDecryptResponse,
-	}, nil
+		metrics:               noopMetrics{},
+		tracer:                otel.GetTracerProvider().Tracer(tracerName),
+		feeSchedules:          DefaultFeeSchedules(),
+		references:            RandomReferenceGenerator{},
+	}
+	for _, opt := range opts {
+		opt(api)
+	}
+	api.buildHandler()
+	return api, nil
 }
 
 func (a *Api) InitiateInterBankTransfer(transfer *InterBankTransferRequest) (*InterBankTransferResult, error) {
+	return a.InitiateInterBankTransferContext(context.Background(), transfer)
+}
+
+func (a *Api) InitiateInterBankTransferContext(ctx context.Context, transfer *InterBankTransferRequest) (_ *InterBankTransferResult, err error) {
+	if transfer == nil {
+		return nil, ErrInvalidArgument
+	}
+
+	if transfer.Reference == "" {
+		ref, err := a.NewReference()
+		if err != nil {
+			return nil, err
+		}
+		transfer.Reference = ref
+	}
+
 	req := interBankTransferRequest{
 		BaseApiReq: BaseApiReq{
 			Referenceid:   transfer.Reference,
-			RequestType:   160,
+			RequestType:   opInterBankTransfer.requestType,
 			Translocation: transfer.Translocation,
 		},
 		SessionID:           transfer.NameEnquirySessionID,
-		FromAccount:         a.config.FromAccount,
+		FromAccount:         a.OriginAccount(ctx),
 		ToAccount:           transfer.ToAccount,
 		Amount:              transfer.Amount,
 		DestinationBankCode: transfer.DestinationBankCode,
@@ -117,212 +240,110 @@ func (a *Api) InitiateInterBankTransfer(transfer *InterBankTransferRequest) (*In
 		req.Translocation = defaultLocation
 	}
 
-	url := "/api/Spay/InterbankTransferReq"
-	method := http.MethodPost
-	inputBytes, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("json encoding: %w", err)
+	amount, amountErr := parseAmount(transfer.Amount)
+	if amountErr != nil && (a.limits != nil || a.funds != nil) {
+		return nil, fmt.Errorf("%w: amount %q", ErrInvalidArgument, transfer.Amount)
 	}
-
-	base64Encrypted, err := a.encrypt(string(inputBytes))
-	if err != nil {
-		return nil, fmt.Errorf("3des encryption: %w", err)
-	}
-	result, err := a.request(url, method, []byte(base64Encrypted))
+	release, err := a.checkLimits(ctx, TransferIntent{
+		Route:       RouteInterbank,
+		FromAccount: req.FromAccount,
+		ToAccount:   transfer.ToAccount,
+		BankCode:    transfer.DestinationBankCode,
+		Amount:      amount,
+		Reference:   transfer.Reference,
+	})
 	if err != nil {
-		if errors.Is(err, ErrInsufficientFunds) {
-			return nil, ErrInsufficientFunds
-		}
-		return nil, fmt.Errorf("interbank transfer request: %w", err)
+		return nil, err
 	}
+	defer func() { releaseIfRejected(release, err) }()
 
-	if a.shouldDecryptResponse {
-		decodedStr, err := a.decrypt(string(result))
-		if err != nil {
-			return nil, fmt.Errorf("decoded interbank transfer response: %w", err)
-		}
-		result = []byte(decodedStr)
+	settle, err := a.checkFunds(ctx, amount, transfer.DestinationBankCode)
+	if err != nil {
+		return nil, err
 	}
+	defer func() { settle(err) }()
 
-	var output InterBankTransferResult
-	if err := json.Unmarshal(result, &output); err != nil {
-		return nil, fmt.Errorf("json decoding: %w", err)
+	output, err := do(ctx, a, interBankTransferSpec, req)
+	if err != nil {
+		return nil, err
 	}
 
-	if output.Response != successfulStatusCode {
-		logrus.WithField("transferResult", output).WithField("request", req).Error("interbank transfer completed without success")
-		return nil, fmt.Errorf("could not complete transfer: %v", output.Message)
+	if amountErr == nil {
+		a.metrics.ObserveTransfer(RouteInterbank, amount)
 	}
 
-	return &output, nil
+	return output, nil
 }
 
 func (a *Api) ListBanks() (ListOfBankResponse, error) {
-	req := ListBanksRequest{
-		BaseApiReq: BaseApiReq{
-			Referenceid:   fmt.Sprintf("%d", time.Now().UnixMilli()),
-			RequestType:   152,
-			Translocation: "N/A", //defaultLocation,
-		},
-	}
-	url := "/api/Spay/GetBankListReq"
-	method := http.MethodPost
-	inputBytes, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("json encoding: %w", err)
-	}
-
-	logrus.WithField("req", string(inputBytes)).Info("request body")
-
-	base64Encrypted, err := a.encrypt(string(inputBytes))
-	if err != nil {
-		return nil, fmt.Errorf("3des encryption: %w", err)
-	}
+	return a.ListBanksContext(context.Background())
+}
 
-	result, err := a.request(url, method, []byte(base64Encrypted))
+func (a *Api) ListBanksContext(ctx context.Context) (ListOfBankResponse, error) {
+	ref, err := a.NewReference()
 	if err != nil {
-		return nil, fmt.Errorf("interbank transfer request: %w", err)
-	}
-
-	if a.shouldDecryptResponse {
-		decodedStr, err := a.decrypt(string(result))
-		if err != nil {
-			return nil, fmt.Errorf("decoded interbank transfer response: %w", err)
-		}
-		result = []byte(decodedStr)
-	}
-
-	var output ApiOperationResponse[ApiOperationResponseData]
-	if err := json.Unmarshal(result, &output); err != nil {
-		return nil, fmt.Errorf("json decoding: %w", err)
-	}
-
-	if output.Data.Status != successfulStatus {
-		return nil, fmt.Errorf("could not complete request: %s", output.Data.Response)
-	}
-
-	var item ListOfBankResponse
-	if err := json.Unmarshal([]byte(output.Data.Response), &item); err != nil {
-		return nil, fmt.Errorf("json decoding: %w", err)
+		return nil, err
 	}
-
-	return item, nil
-}
-
-func (a *Api) GetStatement() (ListOfBankResponse, error) {
 	req := ListBanksRequest{
 		BaseApiReq: BaseApiReq{
-			Referenceid:   fmt.Sprintf("%d", time.Now().UnixMilli()),
-			RequestType:   153,
+			Referenceid:   ref,
+			RequestType:   opListBanks.requestType,
 			Translocation: "N/A", //defaultLocation,
 		},
 	}
-	url := "/api/Spay/GetStatement"
-	method := http.MethodPost
-	inputBytes, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("json encoding: %w", err)
-	}
-
-	logrus.WithField("req", string(inputBytes)).Info("request body")
+	return operationList[ListOfBankResponse](ctx, a, opListBanks, req)
+}
 
-	base64Encrypted, err := a.encrypt(string(inputBytes))
-	if err != nil {
-		return nil, fmt.Errorf("3des encryption: %w", err)
-	}
+// GetStatement runs request type 153 for the source account.
+func (a *Api) GetStatement() ([]StatementLine, error) {
+	return a.GetStatementContext(context.Background())
+}
 
-	result, err := a.request(url, method, []byte(base64Encrypted))
+func (a *Api) GetStatementContext(ctx context.Context) ([]StatementLine, error) {
+	ref, err := a.NewReference()
 	if err != nil {
-		return nil, fmt.Errorf("interbank transfer request: %w", err)
-	}
-
-	if a.shouldDecryptResponse {
-		decodedStr, err := a.decrypt(string(result))
-		if err != nil {
-			return nil, fmt.Errorf("decoded interbank transfer response: %w", err)
-		}
-		result = []byte(decodedStr)
+		return nil, err
 	}
-
-	var output ApiOperationResponse[ApiOperationResponseData]
-	if err := json.Unmarshal(result, &output); err != nil {
-		return nil, fmt.Errorf("json decoding: %w", err)
-	}
-
-	if output.Data.Status != successfulStatus {
-		return nil, fmt.Errorf("could not complete request: %s", output.Data.Response)
-	}
-
-	var item ListOfBankResponse
-	if err := json.Unmarshal([]byte(output.Data.Response), &item); err != nil {
-		return nil, fmt.Errorf("json decoding: %w", err)
-	}
-
-	return item, nil
-}
-
-func (a *Api) BalanceEnquiry() (ListOfBankResponse, error) {
 	req := ListBanksRequest{
 		BaseApiReq: BaseApiReq{
-			Referenceid:   fmt.Sprintf("%d", time.Now().UnixMilli()),
-			RequestType:   151,
-			Translocation: defaultLocation,
+			Referenceid:   ref,
+			RequestType:   opGetStatement.requestType,
+			Translocation: "N/A", //defaultLocation,
 		},
 	}
-	url := "/api/Spay/BalanceEnquiry"
-	method := http.MethodPost
-	inputBytes, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("json encoding: %w", err)
-	}
-
-	logrus.WithField("req", string(inputBytes)).Info("request body")
-
-	base64Encrypted, err := a.encrypt(string(inputBytes))
-	if err != nil {
-		return nil, fmt.Errorf("3des encryption: %w", err)
-	}
+	return operationList[[]StatementLine](ctx, a, opGetStatement, req)
+}
 
-	result, err := a.request(url, method, []byte(base64Encrypted))
+// operationList runs the bank list and statement operations, which share a
+// request and a response shape wrapping a JSON list in Data.Response.
+func operationList[T any](ctx context.Context, a *Api, op operation, req ListBanksRequest) (T, error) {
+	var item T
+	output, err := do(ctx, a, listSpec(op), req)
 	if err != nil {
-		return nil, fmt.Errorf("interbank transfer request: %w", err)
+		return item, err
 	}
 
-	if a.shouldDecryptResponse {
-		decodedStr, err := a.decrypt(string(result))
-		if err != nil {
-			return nil, fmt.Errorf("decoded interbank transfer response: %w", err)
-		}
-		result = []byte(decodedStr)
-	}
-
-	var output ApiOperationResponse[ApiOperationResponseData]
-	if err := json.Unmarshal(result, &output); err != nil {
-		return nil, fmt.Errorf("json decoding: %w", err)
-	}
-
-	if output.Data.Status != successfulStatus {
-		return nil, fmt.Errorf("could not complete request: %s", output.Data.Response)
-	}
-
-	var item ListOfBankResponse
-	if err := json.Unmarshal([]byte(output.Data.Response), &item); err != nil {
-		return nil, fmt.Errorf("json decoding: %w", err)
+	if err := a.decode(ctx, []byte(output.Data.Response), &item); err != nil {
+		return item, &OperationError{Operation: op.name, RequestType: op.requestType, Reference: req.Referenceid, Err: fmt.Errorf("decoding list: %w", err)}
 	}
 
 	return item, nil
 }
 
 func (a *Api) SterlingTransfer(req *SterlingToSterlingTransferRequest) (*SterlingToSterlingTransferResult, error) {
+	return a.SterlingTransferContext(context.Background(), req)
+}
+
+func (a *Api) SterlingTransferContext(ctx context.Context, req *SterlingToSterlingTransferRequest) (_ *SterlingToSterlingTransferResult, err error) {
 
 	if req == nil {
 		return nil, ErrInvalidArgument
 	}
 
 	if req.ReferenceId == "" {
-		ref, err := gonanoid.New(15)
+		ref, err := a.NewReference()
 		if err != nil {
-			return nil, fmt.Errorf("could not generate nano id reference: %w", err)
+			return nil, err
 		}
 		req.ReferenceId = ref
 	}
@@ -334,444 +355,233 @@ func (a *Api) SterlingTransfer(req *SterlingToSterlingTransferRequest) (*Sterlin
 	sterlingReq := sterlingToSterlingTransfer{
 		BaseApiReq: BaseApiReq{
 			Referenceid:   req.ReferenceId,
-			RequestType:   110,
+			RequestType:   opSterlingTransfer.requestType,
 			Translocation: req.Translocation,
 		},
 		Amt:        fmt.Sprintf("%.2f", req.Amt),
 		Tellerid:   req.Tellerid,
-		Frmacct:    a.config.FromAccount,
+		Frmacct:    a.OriginAccount(ctx),
 		Toacct:     req.ToAcct,
 		PaymentRef: req.PaymentRef,
 		Remarks:    req.Remarks,
 	}
 
-	url := "/api/Spay/SBPT24txnRequest"
-	method := http.MethodPost
-	inputBytes, err := json.Marshal(sterlingReq)
+	release, err := a.checkLimits(ctx, TransferIntent{
+		Route:       RouteIntrabank,
+		FromAccount: sterlingReq.Frmacct,
+		ToAccount:   req.ToAcct,
+		BankCode:    sterlingBankCbnCode,
+		Amount:      req.Amt,
+		Reference:   req.ReferenceId,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("json encoding: %w", err)
+		return nil, err
 	}
+	defer func() { releaseIfRejected(release, err) }()
 
-	base64Encrypted, err := a.encrypt(string(inputBytes))
+	settle, err := a.checkFunds(ctx, req.Amt, sterlingBankCbnCode)
 	if err != nil {
-		return nil, fmt.Errorf("3des encryption: %w", err)
+		return nil, err
 	}
+	defer func() { settle(err) }()
 
-	result, err := a.request(url, method, []byte(base64Encrypted))
+	output, err := do(ctx, a, sterlingTransferSpec, sterlingReq)
 	if err != nil {
-		if errors.Is(err, ErrInsufficientFunds) {
-			return nil, ErrInsufficientFunds
-		}
-
-		if errors.Is(err, ErrToAccountNotAllowed) {
-			return nil, ErrToAccountNotAllowed
-		}
-
-		if aErr, ok := err.(*ApiResponseErrorResult); ok {
-			if aErr.Response == ErrToAccountNotAllowed.Response {
-				return nil, ErrToAccountNotAllowed
-			}
-		}
-
-		return nil, fmt.Errorf("intrabank transfer request: %w", err)
-	}
-
-	if a.shouldDecryptResponse {
-		decodedStr, err := a.decrypt(string(result))
-		if err != nil {
-			return nil, fmt.Errorf("decoded interbank transfer response: %w", err)
-		}
-		result = []byte(decodedStr)
-	}
-
-	var output SterlingToSterlingTransferResult
-	if err := json.Unmarshal(result, &output); err != nil {
-		return nil, fmt.Errorf("json decoding: %w", err)
+		return nil, err
 	}
 
-	if output.Response != successfulStatusCode {
-		logrus.WithField("transferResult", output).WithField("request", req).Error("sterling intrabank transfer completed without success")
-		return nil, fmt.Errorf("could not complete transfer: %v", output.Message)
-	}
+	a.metrics.ObserveTransfer(RouteIntrabank, req.Amt)
 
-	return &output, nil
+	return output, nil
 }
 
 func (a *Api) SterlingNameEnquiry(accountNumber string) (*SterlingNameEnquiryResponse, error) {
+	return a.SterlingNameEnquiryContext(context.Background(), accountNumber)
+}
+
+func (a *Api) SterlingNameEnquiryContext(ctx context.Context, accountNumber string) (*SterlingNameEnquiryResponse, error) {
+	ref, err := a.NewReference()
+	if err != nil {
+		return nil, err
+	}
 	req := sterlingNameEnquiryReq{
 		BaseApiReq: BaseApiReq{
-			Referenceid:   fmt.Sprintf("%d", time.Now().UnixMilli()),
-			RequestType:   219,
+			Referenceid:   ref,
+			RequestType:   opSterlingNameEnquiry.requestType,
 			Translocation: defaultLocation,
 		},
 		NUBAN: accountNumber,
 	}
 
-	url := "/api/Spay/SBPNameEnquiry"
-	method := http.MethodPost
-	inputBytes, err := json.Marshal(req)
+	output, err := do(ctx, a, sterlingNameEnquirySpec, req)
 	if err != nil {
-		return nil, fmt.Errorf("json encoding: %w", err)
-	}
-
-	base64Encrypted, err := a.encrypt(string(inputBytes))
-	if err != nil {
-		return nil, fmt.Errorf("3des encryption: %w", err)
-	}
-
-	result, err := a.request(url, method, []byte(base64Encrypted))
-	if err != nil {
-		return nil, fmt.Errorf("interbank transfer request: %w", err)
-	}
-
-	if a.shouldDecryptResponse {
-		decodedStr, err := a.decrypt(string(result))
-		if err != nil {
-			return nil, fmt.Errorf("decoded interbank transfer response: %w", err)
-		}
-		result = []byte(decodedStr)
-	}
-
-	var output ApiOperationResponse[SterlingNameEnquiryResponse]
-	if err := json.Unmarshal(result, &output); err != nil {
-		return nil, fmt.Errorf("json decoding: %w", err)
-	}
-
-	if output.Data.Status != successfulStatusCode {
-		return nil, fmt.Errorf("could not complete request: %s", output.Response)
+		return nil, err
 	}
-
 	return &output.Data, nil
 }
 
 func (a *Api) OtherBanksNameEnquiry(accountNumber, bankCode string) (*InterbankNameEnquiryResponseData, error) {
-	ref, err := gonanoid.New(15)
+	return a.OtherBanksNameEnquiryContext(context.Background(), accountNumber, bankCode)
+}
+
+func (a *Api) OtherBanksNameEnquiryContext(ctx context.Context, accountNumber, bankCode string) (*InterbankNameEnquiryResponseData, error) {
+	ref, err := a.NewReference()
 	if err != nil {
-		return nil, fmt.Errorf("could not generate nano id reference: %w", err)
+		return nil, err
 	}
 	req := interBankNameEnquiryReq{
 		BaseApiReq: BaseApiReq{
 			Referenceid:   ref,
-			RequestType:   161,
+			RequestType:   opOtherBanksNameEnquiry.requestType,
 			Translocation: defaultLocation,
 		},
 		ToAccount:           accountNumber,
 		DestinationBankCode: bankCode,
 	}
 
-	url := "/api/Spay/InterbankNameEnquiry"
-	method := http.MethodPost
-	inputBytes, err := json.Marshal(req)
+	output, err := do(ctx, a, otherBanksNameEnquirySpec, req)
 	if err != nil {
-		return nil, fmt.Errorf("json encoding: %w", err)
+		return nil, err
 	}
-
-	base64Encrypted, err := a.encrypt(string(inputBytes))
-	if err != nil {
-		return nil, fmt.Errorf("3des encryption: %w", err)
-	}
-
-	result, err := a.request(url, method, []byte(base64Encrypted))
-	if err != nil {
-		return nil, fmt.Errorf("interbank transfer request: %w", err)
-	}
-
-	if a.shouldDecryptResponse {
-		decodedStr, err := a.decrypt(string(result))
-		if err != nil {
-			return nil, fmt.Errorf("decoded interbank transfer response: %w", err)
-		}
-		result = []byte(decodedStr)
-	}
-
-	logrus.WithField("rawResult", string(result)).Info("printing raw result")
-
-	var output InterbankNameEnquiryResponse
-	if err := json.Unmarshal(result, &output); err != nil {
-		return nil, fmt.Errorf("json decoding: %w", err)
-	}
-
-	if output.Data.Status != successfulStatusCode {
-		return nil, fmt.Errorf("could not complete request: %s", output.Response)
-	}
-
 	return &output.Data, nil
 }
 
 func (a *Api) ListInflowsForToday() (*ListInflowResponse, error) {
+	return a.ListInflowsForTodayContext(context.Background())
+}
+
+func (a *Api) ListInflowsForTodayContext(ctx context.Context) (_ *ListInflowResponse, err error) {
+	ctx, span := a.startOperation(ctx, opListInflowsForToday, "")
+	defer func() { endSpan(span, err) }()
 
 	todayDate := time.Now().Format("2006-01-02")
 	reqData := map[string]any{
-		"accountNumber": a.config.FromAccount,
+		"accountNumber": a.OriginAccount(ctx),
 		"startDate":     todayDate,
 		"endDate":       todayDate,
 	}
-	reqDataBytes, err := json.Marshal(reqData)
-	if err != nil {
-		return nil, fmt.Errorf("list inflows for today failed: %w", err)
-	}
-
-	dataReader := bytes.NewReader(reqDataBytes)
-	url := "https://epayments.sterling.ng/NIPRequery/api/GetTransactionController/GetTransactionByAccount"
-	newReq, err := http.NewRequest(http.MethodGet, url, dataReader)
-	if err != nil {
-		return nil, fmt.Errorf("request for requery: %w", err)
-	}
-
-	newReq.Header.Add("Content-Type", "application/json")
-	logrus.
-		WithField("url", url).
-		WithField("method", "GET").
-		WithField("body", string(reqDataBytes)).
-		Info("sending request for inflow re-query")
-
-	result, err := a.httpClient.Do(newReq)
-	if err != nil {
-		return nil, fmt.Errorf("inflow re-query response: %w", err)
-	}
-
-	if result.Body != nil {
-		defer result.Body.Close()
-	}
-
-	resultBytes, err := io.ReadAll(result.Body)
-	if err != nil {
-		return nil, fmt.Errorf("spay response reading: %w", err)
-	}
-
-	logrus.
-		WithField("status", result.Status).
-		WithField("statusCode", result.StatusCode).
-		WithField("statusCodeText", http.StatusText(result.StatusCode)).
-		WithField("body", string(resultBytes)).
-		Info("response result")
-
-	if result.StatusCode < 200 || result.StatusCode > 299 {
-		if len(resultBytes) <= 0 {
-			return nil, fmt.Errorf("empty response received: %s", result.Status)
-		}
-
-		var errMsg ApiResponseErrorResult
-		if err := json.Unmarshal(resultBytes, &errMsg); err != nil {
-			return nil, fmt.Errorf("could not unmarshal error response to error obj: %w", err)
-		}
-		return nil, &errMsg
-	}
 
 	var resultStruct ListInflowResponse
-	if err := json.Unmarshal(resultBytes, &resultStruct); err != nil {
-		return nil, fmt.Errorf("could not unmarshal response to inflow result obj: %w", err)
+	if err := a.requery(ctx, opListInflowsForToday, transactionByAccountUrl, http.MethodGet, reqData, &resultStruct); err != nil {
+		return nil, err
 	}
 
 	return &resultStruct, nil
 }
 
 func (a *Api) ListInflowsForTodayForAccountID(accountNumber string) (*ListInflowForAccountResponse, error) {
+	return a.ListInflowsForTodayForAccountIDContext(context.Background(), accountNumber)
+}
+
+func (a *Api) ListInflowsForTodayForAccountIDContext(ctx context.Context, accountNumber string) (_ *ListInflowForAccountResponse, err error) {
+	ctx, span := a.startOperation(ctx, opListInflowsForAccount, "")
+	defer func() { endSpan(span, err) }()
 
 	reqData := map[string]any{
 		"AccountNumber": accountNumber,
 		"SessionID":     "",
 	}
-	reqDataBytes, err := json.Marshal(reqData)
-	if err != nil {
-		return nil, fmt.Errorf("list inflows for today failed: %w", err)
-	}
-
-	dataReader := bytes.NewReader(reqDataBytes)
-	url := "https://epayments.sterling.ng/NIPrequeryV2/api/v1.0/NIP/FetchTransactionStatus"
-	newReq, err := http.NewRequest(http.MethodPost, url, dataReader)
-	if err != nil {
-		return nil, fmt.Errorf("request for requery: %w", err)
-	}
-
-	newReq.Header.Add("Content-Type", "application/json")
-	logrus.
-		WithField("url", url).
-		WithField("method", "GET").
-		WithField("body", string(reqDataBytes)).
-		Info("sending request for inflow re-query")
-
-	result, err := a.httpClient.Do(newReq)
-	if err != nil {
-		return nil, fmt.Errorf("inflow re-query response: %w", err)
-	}
-
-	if result.Body != nil {
-		defer result.Body.Close()
-	}
-
-	resultBytes, err := io.ReadAll(result.Body)
-	if err != nil {
-		return nil, fmt.Errorf("spay response reading: %w", err)
-	}
-
-	logrus.
-		WithField("status", result.Status).
-		WithField("statusCode", result.StatusCode).
-		WithField("statusCodeText", http.StatusText(result.StatusCode)).
-		WithField("body", string(resultBytes)).
-		Info("response result")
-
-	if result.StatusCode < 200 || result.StatusCode > 299 {
-		if len(resultBytes) <= 0 {
-			return nil, fmt.Errorf("empty response received: %s", result.Status)
-		}
-
-		var errMsg ApiResponseErrorResult
-		if err := json.Unmarshal(resultBytes, &errMsg); err != nil {
-			return nil, fmt.Errorf("could not unmarshal error response to error obj: %w", err)
-		}
-		return nil, &errMsg
-	}
 
 	var resultStruct ListInflowForAccountResponse
-	if err := json.Unmarshal(resultBytes, &resultStruct); err != nil {
-		return nil, fmt.Errorf("could not unmarshal response to inflow result obj: %w", err)
+	if err := a.requery(ctx, opListInflowsForAccount, transactionStatusUrl, http.MethodPost, reqData, &resultStruct); err != nil {
+		return nil, err
 	}
 
 	resultStruct.Content = lo.Filter(resultStruct.Content, func(item InflowForAccountItem, i int) bool {
-		return item.AccountNumber != a.config.FromAccount
+		return item.AccountNumber != a.OriginAccount(ctx)
 	})
 
 	return &resultStruct, nil
 }
 
 func (a *Api) QueryInflowsBySessionID(sessionID string, date time.Time) (*ListInflowForAccountResponse, error) {
+	return a.QueryInflowsBySessionIDContext(context.Background(), sessionID, date)
+}
 
-	reqData := map[string]any{
-		"SessionID":  sessionID,
-		"StartDate":  date.Format("2006-01-02"),
-		"pageNumber": 1,
-	}
-	reqDataBytes, err := json.Marshal(reqData)
-	if err != nil {
-		return nil, fmt.Errorf("list inflows for today failed: %w", err)
-	}
+func (a *Api) QueryInflowsBySessionIDContext(ctx context.Context, sessionID string, date time.Time) (_ *ListInflowForAccountResponse, err error) {
+	ctx, span := a.startOperation(ctx, opQueryInflowsBySessionID, sessionID)
+	defer func() { endSpan(span, err) }()
 
-	dataReader := bytes.NewReader(reqDataBytes)
-	url := "https://epayments.sterling.ng/NIPrequeryV2/api/v1.0/NIP/FetchPreviousTransactionsStatus"
-	newReq, err := http.NewRequest(http.MethodPost, url, dataReader)
+	resultStruct, err := a.fetchPreviousTransactionsPage(ctx, opQueryInflowsBySessionID, sessionID, date, 1)
 	if err != nil {
-		return nil, fmt.Errorf("request for requery: %w", err)
+		return nil, err
 	}
 
-	newReq.Header.Add("Content-Type", "application/json")
-	logrus.
-		WithField("url", url).
-		WithField("method", "GET").
-		WithField("body", string(reqDataBytes)).
-		Info("sending request for inflow re-query")
-
-	result, err := a.httpClient.Do(newReq)
-	if err != nil {
-		return nil, fmt.Errorf("inflow re-query response: %w", err)
-	}
+	resultStruct.Content = lo.Filter(resultStruct.Content, func(item InflowForAccountItem, i int) bool {
+		return item.AccountNumber != a.OriginAccount(ctx)
+	})
 
-	if result.Body != nil {
-		defer result.Body.Close()
-	}
+	return resultStruct, nil
+}
 
-	resultBytes, err := io.ReadAll(result.Body)
+// send marshals payload, encrypts it, posts it to op and returns the
+// response body, decrypted when the Api is configured to.
+func (a *Api) send(ctx context.Context, op operation, payload any) (_ *Reply, err error) {
+	inputBytes, err := json.Marshal(payload)
 	if err != nil {
-		return nil, fmt.Errorf("spay response reading: %w", err)
+		return nil, fmt.Errorf("json encoding: %w", err)
 	}
 
-	logrus.
-		WithField("status", result.Status).
-		WithField("statusCode", result.StatusCode).
-		WithField("statusCodeText", http.StatusText(result.StatusCode)).
-		WithField("body", string(resultBytes)).
-		Info("response result")
-
-	if result.StatusCode < 200 || result.StatusCode > 299 {
-		if len(resultBytes) <= 0 {
-			return nil, fmt.Errorf("empty response received: %s", result.Status)
-		}
-
-		var errMsg ApiResponseErrorResult
-		if err := json.Unmarshal(resultBytes, &errMsg); err != nil {
-			return nil, fmt.Errorf("could not unmarshal error response to error obj: %w", err)
+	var reference string
+	if r, ok := payload.(interface{ reference() string }); ok {
+		reference = r.reference()
+		if a.referenceFormat != (ReferenceFormat{}) {
+			if err := a.referenceFormat.Validate(reference); err != nil {
+				return nil, err
+			}
 		}
-		return nil, &errMsg
 	}
-
-	var resultStruct ListInflowForAccountResponse
-	if err := json.Unmarshal(resultBytes, &resultStruct); err != nil {
-		return nil, fmt.Errorf("could not unmarshal response to inflow result obj: %w", err)
+	if err := a.auditRequest(ctx, op, reference, inputBytes); err != nil {
+		return nil, err
 	}
+	start := time.Now()
+	// handled is the reply as received, kept for the audit when err drops it
+	var handled *Reply
+	defer func() { a.auditResponse(ctx, op, reference, handled, err, time.Since(start)) }()
 
-	resultStruct.Content = lo.Filter(resultStruct.Content, func(item InflowForAccountItem, i int) bool {
-		return item.AccountNumber != a.config.FromAccount
-	})
-
-	return &resultStruct, nil
-}
-
-func (a *Api) request(uri, method string, data []byte) ([]byte, error) {
-
-	var dataReader io.Reader
-	if len(data) > 0 {
-		dataReader = bytes.NewReader(data)
-	}
-	url := fmt.Sprintf("%s%s", a.config.baseUrl, uri)
-	newReq, err := http.NewRequest(method, url, dataReader)
+	base64Encrypted, err := a.encrypt(ctx, string(inputBytes))
 	if err != nil {
-		return nil, fmt.Errorf("spay request: %w", err)
+		return nil, fmt.Errorf("3des encryption: %w", err)
 	}
 
-	newReq.Header.Add("AppId", fmt.Sprintf("%d", a.config.appId))
-	logrus.
-		WithField("url", url).
-		WithField("method", method).
-		WithField("body", string(data)).
-		WithField("AppId", a.config.appId).
-		Info("sending request")
-
-	result, err := a.httpClient.Do(newReq)
-	if err != nil {
-		return nil, fmt.Errorf("spay response: %w", err)
+	call := &Call{
+		Operation:   op.name,
+		RequestType: op.requestType,
+		Reference:   reference,
+		Method:      http.MethodPost,
+		Url:         fmt.Sprintf("%s%s", a.config.baseUrl, op.path),
+		Header:      http.Header{"AppId": []string{fmt.Sprintf("%d", a.config.appId)}},
+		Payload:     inputBytes,
+		Body:        []byte(base64Encrypted),
+		Encrypted:   true,
+		decrypt:     a.shouldDecrypt(op),
+		op:          op,
 	}
-
-	if result.Body != nil {
-		defer result.Body.Close()
+	if a.dryRun {
+		return nil, &DryRunError{Method: call.Method, Url: call.Url, Body: call.Body, Encrypted: true}
 	}
 
-	resultBytes, err := io.ReadAll(result.Body)
+	handled, err = a.handler(ctx, call)
 	if err != nil {
-		return nil, fmt.Errorf("spay response reading: %w", err)
+		return nil, err
 	}
+	return handled, nil
+}
 
-	logrus.
-		WithField("status", result.Status).
-		WithField("statusCode", result.StatusCode).
-		WithField("statusCodeText", http.StatusText(result.StatusCode)).
-		WithField("body", string(resultBytes)).
-		Info("response result")
-
-	if result.StatusCode < 200 || result.StatusCode > 299 {
-
-		logrus.
-			WithField("status", result.Status).
-			WithField("statusCode", result.StatusCode).
-			WithField("statusCodeText", http.StatusText(result.StatusCode)).
-			WithField("body", string(resultBytes)).
-			Error("spay error response result")
-
-		if len(resultBytes) <= 0 {
-			return nil, fmt.Errorf("empty response received: %s", result.Status)
-		}
+func (a *Api) decode(ctx context.Context, data []byte, out any) (err error) {
+	_, span := a.tracer.Start(ctx, "decode")
+	defer func() { endSpan(span, err) }()
 
-		var errMsg ApiResponseErrorResult
-		if err := json.Unmarshal(resultBytes, &errMsg); err != nil {
-			return nil, fmt.Errorf("could not unmarshal error response to error obj: %w", err)
-		}
-		return nil, &errMsg
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("json decoding: %w", err)
 	}
-
-	return resultBytes, nil
+	return nil
 }
 
-func (a *Api) encrypt(val string) (string, error) {
+func (a *Api) encrypt(ctx context.Context, val string) (_ string, err error) {
+	_, span := a.tracer.Start(ctx, "encrypt")
+	defer func() { endSpan(span, err) }()
+
 	sharedKeyVal, err := a.config.sharedKey.AsByteSlice()
 	if err != nil {
 		return "", err
@@ -782,20 +592,13 @@ func (a *Api) encrypt(val string) (string, error) {
 		return "", err
 	}
 
-	logrus.WithField("sharedKeyVal", fmt.Sprintf("%x", sharedKeyVal)).
-		WithField("sharedVectorVal", fmt.Sprintf("%x", sharedVectorVal)).
-		Info("binary conversion to string")
-	encryptedResult, err := TripleDESCBCEncrypt(val, sharedKeyVal, sharedVectorVal)
-	if err != nil {
-		return "", err
-	}
-
-	decrypedResult, err := TripleDESCBCDecrypt(encryptedResult, sharedKeyVal, sharedVectorVal)
-	logrus.WithField("decryptedResult", decrypedResult).WithError(err).Info("decryption test")
-	return encryptedResult, nil
+	return TripleDESCBCEncrypt(val, sharedKeyVal, sharedVectorVal)
 }
 
-func (a *Api) decrypt(val string) (string, error) {
+func (a *Api) decrypt(ctx context.Context, val string) (_ string, err error) {
+	_, span := a.tracer.Start(ctx, "decrypt")
+	defer func() { endSpan(span, err) }()
+
 	sharedKeyVal, err := a.config.sharedKey.AsByteSlice()
 	if err != nil {
 		return "", err
@@ -804,13 +607,18 @@ func (a *Api) decrypt(val string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return TripleDESCBCEncrypt(val, sharedKeyVal, sharedVectorVal)
+	return TripleDESCBCDecryptUnpadded(val, sharedKeyVal, sharedVectorVal)
 }
 
+// GetTransferCost returns a flat fee of 10 naira.
+//
+// Deprecated: NIP fees depend on the amount and route; use QuoteTransfer.
 func (a *Api) GetTransferCost() float64 {
 	return a.config.transferCost
 }
 
+// GetOriginAccount returns the source account given to NewApi; see
+// OriginAccount for the one a call actually uses.
 func (a *Api) GetOriginAccount() string {
 	return a.config.FromAccount
 }
@@ -0,0 +1,51 @@
+package spay
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestMain(m *testing.M) {
+	logrus.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newTestApi returns an Api for account 0000000001 whose Spay and requery
+// requests all go to handler.
+func newTestApi(t *testing.T, handler http.HandlerFunc, opts ...Option) *Api {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	redirect := func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (*Reply, error) {
+			u, err := url.Parse(call.Url)
+			if err != nil {
+				return nil, err
+			}
+			call.Url = srv.URL + u.Path
+			return next(ctx, call)
+		}
+	}
+	api, err := NewApi(bitString(testVector), bitString(testKey), 1, "0000000001", false, srv.URL,
+		append(opts, WithInterceptors(redirect))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api
+}
+
+// reply answers every request with status and body.
+func reply(status int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}
+}
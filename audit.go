@@ -0,0 +1,353 @@
+package spay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Audit phases. Every operation records an intent entry before anything is
+// sent and a result entry once it completes.
+const (
+	AuditPhaseRequest  = "request"
+	AuditPhaseResponse = "response"
+)
+
+// ErrAuditChainBroken is returned by VerifyAuditLog when an entry does not
+// chain onto the one before it.
+var ErrAuditChainBroken = errors.New("audit chain broken")
+
+// redactedFields are removed from audited payloads wherever they appear.
+var redactedFields = []string{"BVN", "pin", "password", "token"}
+
+// AuditEntry describes one phase of one operation. Payload is the plaintext
+// request with sensitive fields redacted; Response is the response body,
+// decrypted and redacted, when there was one, error responses included.
+// Status is the HTTP status and Code the Spay response code. Error is set
+// when the exchange failed; a 2xx reply whose code the operation then
+// treats as a failure shows only in Code.
+type AuditEntry struct {
+	Time        time.Time       `json:"time"`
+	Phase       string          `json:"phase"`
+	Operation   string          `json:"operation"`
+	RequestType int             `json:"requestType,omitempty"`
+	Reference   string          `json:"reference,omitempty"`
+	Principal   string          `json:"principal,omitempty"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Response    json.RawMessage `json:"response,omitempty"`
+	Status      int             `json:"status,omitempty"`
+	Code        string          `json:"code,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Duration    time.Duration   `json:"duration,omitempty"`
+}
+
+// AuditSink receives an entry for every operation the Api performs. An error
+// recording the request phase aborts the operation before anything is sent.
+type AuditSink interface {
+	Record(ctx context.Context, entry AuditEntry) error
+}
+
+// WithAuditSink records every operation to sink.
+func WithAuditSink(sink AuditSink) Option {
+	return func(a *Api) {
+		a.audit = sink
+	}
+}
+
+type principalKey struct{}
+
+// WithPrincipal attaches the identity of whoever initiated the work in ctx,
+// which audit entries then carry.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal set with WithPrincipal.
+func PrincipalFromContext(ctx context.Context) string {
+	principal, _ := ctx.Value(principalKey{}).(string)
+	return principal
+}
+
+func (a *Api) auditRequest(ctx context.Context, op operation, reference string, payload []byte) error {
+	if a.audit == nil || a.dryRun {
+		return nil
+	}
+	err := a.audit.Record(ctx, AuditEntry{
+		Time:        time.Now().UTC(),
+		Phase:       AuditPhaseRequest,
+		Operation:   op.name,
+		RequestType: op.requestType,
+		Reference:   reference,
+		Principal:   PrincipalFromContext(ctx),
+		Payload:     redactJson(payload),
+	})
+	if err != nil {
+		return fmt.Errorf("audit %s: %w", op.name, err)
+	}
+	return nil
+}
+
+func (a *Api) auditResponse(ctx context.Context, op operation, reference string, reply *Reply, opErr error, duration time.Duration) {
+	if a.audit == nil || a.dryRun {
+		return
+	}
+	entry := AuditEntry{
+		Time:        time.Now().UTC(),
+		Phase:       AuditPhaseResponse,
+		Operation:   op.name,
+		RequestType: op.requestType,
+		Reference:   reference,
+		Principal:   PrincipalFromContext(ctx),
+		Duration:    duration,
+	}
+	if reply != nil {
+		body := reply.Body
+		// error responses are not encrypted and are never decrypted
+		if reply.Status < 200 || reply.Status > 299 {
+			body = reply.Raw
+		}
+		entry.Response = redactJson(body)
+		entry.Status = reply.Status
+		var coded struct {
+			Response string `json:"response"`
+		}
+		if json.Unmarshal(body, &coded) == nil {
+			entry.Code = coded.Response
+		}
+	}
+	if opErr != nil {
+		entry.Error = opErr.Error()
+		var e *OperationError
+		if errors.As(opErr, &e) && e.Code != "" {
+			entry.Code = e.Code
+		}
+	}
+	// the operation has already happened, so a failure here can only be reported
+	if err := a.audit.Record(ctx, entry); err != nil {
+		logrus.WithError(err).WithField("operation", op.name).WithField("reference", reference).Error("could not record audit entry")
+	}
+}
+
+// redactJson blanks redactedFields in a JSON document. Bodies that are not
+// JSON are kept as a JSON string so the entry stays valid.
+func redactJson(data []byte) json.RawMessage {
+	if len(data) == 0 {
+		return nil
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		quoted, _ := json.Marshal(string(data))
+		return quoted
+	}
+	out, err := json.Marshal(redactValue(doc))
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+func redactValue(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, item := range val {
+			if isRedactedField(k) {
+				val[k] = "[redacted]"
+				continue
+			}
+			val[k] = redactValue(item)
+		}
+	case []any:
+		for i, item := range val {
+			val[i] = redactValue(item)
+		}
+	}
+	return v
+}
+
+func isRedactedField(name string) bool {
+	for _, field := range redactedFields {
+		if strings.EqualFold(name, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// auditRecord is one line of a FileAuditSink. Hash covers the sequence
+// number, the previous hash and the exact entry bytes, so editing, removing
+// or reordering any line breaks every hash after it. Lines cut off the end
+// leave a shorter chain that is still valid; only an AuditHead kept
+// elsewhere shows they are gone.
+type auditRecord struct {
+	Seq      uint64          `json:"seq"`
+	PrevHash string          `json:"prevHash"`
+	Hash     string          `json:"hash"`
+	Entry    json.RawMessage `json:"entry"`
+}
+
+func auditHash(seq uint64, prevHash string, entry []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n%s\n", seq, prevHash)
+	h.Write(entry)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// AuditHead identifies the newest entry of an audit log. Saved outside the
+// log, say in a database or a monitoring system, it lets VerifyAuditLogHead
+// detect entries removed from the end.
+type AuditHead struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// FileAuditSink appends hash-chained JSON lines to a file. It is safe for
+// concurrent use within one process; only one process may write a file.
+type FileAuditSink struct {
+	mu       sync.Mutex
+	file     *os.File
+	seq      uint64
+	lastHash string
+}
+
+var _ AuditSink = (*FileAuditSink)(nil)
+
+// NewFileAuditSink opens or creates path, verifying any existing chain so new
+// entries continue it.
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+
+	sink := &FileAuditSink{file: file}
+	last, err := verifyAuditLog(file, nil)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("existing audit log %s: %w", path, err)
+	}
+	if last != nil {
+		sink.seq = last.Seq
+		sink.lastHash = last.Hash
+	}
+	return sink, nil
+}
+
+func (f *FileAuditSink) Record(_ context.Context, entry AuditEntry) error {
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	seq := f.seq + 1
+	record := auditRecord{
+		Seq:      seq,
+		PrevHash: f.lastHash,
+		Hash:     auditHash(seq, f.lastHash, entryBytes),
+		Entry:    entryBytes,
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := f.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := f.file.Sync(); err != nil {
+		return err
+	}
+	f.seq = seq
+	f.lastHash = record.Hash
+	return nil
+}
+
+// Head returns the newest entry written or found in the file.
+func (f *FileAuditSink) Head() AuditHead {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return AuditHead{Seq: f.seq, Hash: f.lastHash}
+}
+
+func (f *FileAuditSink) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+// VerifyAuditLog checks every line written by a FileAuditSink and returns
+// the number of entries verified. A broken chain is reported as
+// ErrAuditChainBroken with the offending line. Edits, removals and
+// reordering are detected anywhere except at the end: a log truncated
+// after any entry still verifies. Use VerifyAuditLogHead to catch that.
+func VerifyAuditLog(r io.Reader) (int, error) {
+	return verifiedCount(verifyAuditLog(r, nil))
+}
+
+// VerifyAuditLogHead is VerifyAuditLog for a log that must also still
+// contain head, an earlier FileAuditSink.Head.
+func VerifyAuditLogHead(r io.Reader, head AuditHead) (int, error) {
+	return verifiedCount(verifyAuditLog(r, &head))
+}
+
+func verifiedCount(last *auditRecord, err error) (int, error) {
+	if last == nil {
+		return 0, err
+	}
+	return int(last.Seq), err
+}
+
+func verifyAuditLog(r io.Reader, head *AuditHead) (*auditRecord, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var last *auditRecord
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+
+		var record auditRecord
+		if err := json.Unmarshal(raw, &record); err != nil {
+			return last, fmt.Errorf("%w: line %d: %v", ErrAuditChainBroken, line, err)
+		}
+
+		wantSeq, wantPrev := uint64(1), ""
+		if last != nil {
+			wantSeq, wantPrev = last.Seq+1, last.Hash
+		}
+		if record.Seq != wantSeq || record.PrevHash != wantPrev {
+			return last, fmt.Errorf("%w: line %d does not follow entry %d", ErrAuditChainBroken, line, wantSeq-1)
+		}
+		if record.Hash != auditHash(record.Seq, record.PrevHash, record.Entry) {
+			return last, fmt.Errorf("%w: line %d hash does not match its contents", ErrAuditChainBroken, line)
+		}
+		if head != nil && record.Seq == head.Seq && record.Hash != head.Hash {
+			return last, fmt.Errorf("%w: line %d is not the entry %d recorded as the head", ErrAuditChainBroken, line, head.Seq)
+		}
+		last = &record
+	}
+	if err := scanner.Err(); err != nil {
+		return last, err
+	}
+	if head != nil && head.Seq > 0 && (last == nil || last.Seq < head.Seq) {
+		return last, fmt.Errorf("%w: log ends before entry %d recorded as the head", ErrAuditChainBroken, head.Seq)
+	}
+	return last, nil
+}
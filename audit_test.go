@@ -0,0 +1,172 @@
+package spay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeAuditLog records n entries to a fresh FileAuditSink and returns the
+// file's lines and the sink's head.
+func writeAuditLog(t *testing.T, n int) ([][]byte, AuditHead) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewFileAuditSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if err := sink.Record(context.Background(), AuditEntry{Phase: AuditPhaseRequest, Operation: OpListBanks, Reference: string(rune('a' + i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	head := sink.Head()
+	sink.Close()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.SplitAfter(bytes.TrimSuffix(data, []byte("\n")), []byte("\n")), head
+}
+
+func TestVerifyAuditLog(t *testing.T) {
+	tests := []struct {
+		name      string
+		change    func(lines [][]byte) [][]byte
+		wantN     int
+		wantBroke bool
+		// wantHeadBroke is the verdict of VerifyAuditLogHead
+		wantHeadBroke bool
+	}{
+		{name: "intact", change: func(l [][]byte) [][]byte { return l }, wantN: 4},
+		{name: "edited", change: func(l [][]byte) [][]byte {
+			l[1] = bytes.Replace(l[1], []byte(`"reference":"b"`), []byte(`"reference":"x"`), 1)
+			return l
+		}, wantN: 1, wantBroke: true, wantHeadBroke: true},
+		{name: "middle removed", change: func(l [][]byte) [][]byte {
+			return append(l[:1:1], l[2:]...)
+		}, wantN: 1, wantBroke: true, wantHeadBroke: true},
+		{name: "reordered", change: func(l [][]byte) [][]byte {
+			l[1], l[2] = l[2], l[1]
+			return l
+		}, wantN: 1, wantBroke: true, wantHeadBroke: true},
+		{name: "tail removed", change: func(l [][]byte) [][]byte {
+			return l[:2]
+		}, wantN: 2, wantHeadBroke: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, head := writeAuditLog(t, 4)
+			log := bytes.Join(tt.change(lines), nil)
+
+			n, err := VerifyAuditLog(bytes.NewReader(log))
+			if n != tt.wantN || errors.Is(err, ErrAuditChainBroken) != tt.wantBroke {
+				t.Errorf("VerifyAuditLog = %d, %v; want %d, broken %v", n, err, tt.wantN, tt.wantBroke)
+			}
+			_, err = VerifyAuditLogHead(bytes.NewReader(log), head)
+			if errors.Is(err, ErrAuditChainBroken) != tt.wantHeadBroke {
+				t.Errorf("VerifyAuditLogHead = %v; want broken %v", err, tt.wantHeadBroke)
+			}
+		})
+	}
+}
+
+func TestFileAuditSinkContinuesChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for i := 0; i < 2; i++ {
+		sink, err := NewFileAuditSink(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Record(context.Background(), AuditEntry{Phase: AuditPhaseRequest, Operation: OpListBanks}); err != nil {
+			t.Fatal(err)
+		}
+		sink.Close()
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if n, err := VerifyAuditLog(f); n != 2 || err != nil {
+		t.Errorf("VerifyAuditLog = %d, %v; want 2 entries", n, err)
+	}
+}
+
+type memoryAuditSink struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+}
+
+func (s *memoryAuditSink) Record(_ context.Context, entry AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func TestAuditResponseEntry(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		body         string
+		wantResponse string
+		wantCode     string
+		wantErr      bool
+	}{
+		{name: "sent", status: 200, body: `{"response":"00","message":"ok"}`, wantResponse: `{"message":"ok","response":"00"}`, wantCode: "00"},
+		{name: "declined", status: 200, body: `{"response":"51","message":"no funds"}`, wantResponse: `{"message":"no funds","response":"51"}`, wantCode: "51"},
+		{
+			name:         "rejected",
+			status:       400,
+			body:         `{"response":"x51","message":"declined","data":{"ResponseText":"Insufficient Funds","token":"secret"}}`,
+			wantResponse: `{"data":{"ResponseText":"Insufficient Funds","token":"[redacted]"},"message":"declined","response":"x51"}`,
+			wantCode:     "x51",
+			wantErr:      true,
+		},
+		{name: "bad gateway", status: 502, body: `<html>Bad gateway</html>`, wantResponse: `"\u003chtml\u003eBad gateway\u003c/html\u003e"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &memoryAuditSink{}
+			api := newTestApi(t, reply(tt.status, tt.body), WithAuditSink(sink))
+			api.SterlingTransferContext(WithPrincipal(context.Background(), "ops"), &SterlingToSterlingTransferRequest{ReferenceId: "ref-1", ToAcct: "0000000002", Amt: 100})
+
+			if len(sink.entries) != 2 {
+				t.Fatalf("%d audit entries, want a request and a response", len(sink.entries))
+			}
+			got := sink.entries[1]
+			if got.Phase != AuditPhaseResponse || got.Reference != "ref-1" || got.Principal != "ops" || got.Status != tt.status {
+				t.Errorf("response entry %+v", got)
+			}
+			if string(got.Response) != tt.wantResponse || got.Code != tt.wantCode {
+				t.Errorf("response %s, code %q; want %s, %q", got.Response, got.Code, tt.wantResponse, tt.wantCode)
+			}
+			if (got.Error != "") != tt.wantErr {
+				t.Errorf("error %q, want one %v", got.Error, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuditRequeryErrorResponse(t *testing.T) {
+	sink := &memoryAuditSink{}
+	api := newTestApi(t, reply(400, `{"response":"x03","message":"Invalid account"}`), WithAuditSink(sink))
+	it := api.ListInflows(context.Background(), InflowQuery{From: time.Date(2024, 3, 4, 0, 0, 0, 0, Lagos)})
+	for it.Next() {
+	}
+	if len(sink.entries) != 2 {
+		t.Fatalf("%d audit entries, want a request and a response", len(sink.entries))
+	}
+	got := sink.entries[1]
+	var body map[string]string
+	if err := json.Unmarshal(got.Response, &body); err != nil || body["response"] != "x03" || got.Code != "x03" || got.Status != 400 || got.Error == "" {
+		t.Errorf("response entry %+v", got)
+	}
+}
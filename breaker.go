@@ -0,0 +1,272 @@
+package spay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Circuit breaker names, one per upstream host.
+const (
+	BreakerSpay    = "spay"
+	BreakerRequery = "requery"
+)
+
+// ErrCircuitOpen is wrapped when a request is refused because its circuit
+// breaker is open. Nothing was sent.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// BreakerSettings configures the circuit breakers. A breaker opens when at
+// least MinRequests requests finished within Window and FailureRate of them
+// failed. After OpenFor it lets HalfOpenProbes requests through at once and
+// closes when that many succeed in a row; any failed probe reopens it.
+//
+// Failures are requests that got no response or a 5xx. Spay rejections such
+// as insufficient funds are answers, not failures, and requests abandoned
+// by their own context are not counted.
+type BreakerSettings struct {
+	Window         time.Duration
+	MinRequests    int
+	FailureRate    float64
+	OpenFor        time.Duration
+	HalfOpenProbes int
+	// OnStateChange is called, without locks held, whenever a breaker
+	// changes state.
+	OnStateChange func(name string, from, to CircuitState)
+}
+
+// WithCircuitBreaker guards the Spay gateway and the requery service with
+// their own breaker. Zero settings default to a 30s window, 10 requests,
+// a 50% failure rate, 30s open and one probe.
+func WithCircuitBreaker(settings BreakerSettings) Option {
+	return func(a *Api) {
+		if settings.Window <= 0 {
+			settings.Window = 30 * time.Second
+		}
+		if settings.MinRequests <= 0 {
+			settings.MinRequests = 10
+		}
+		if settings.FailureRate <= 0 || settings.FailureRate > 1 {
+			settings.FailureRate = 0.5
+		}
+		if settings.OpenFor <= 0 {
+			settings.OpenFor = 30 * time.Second
+		}
+		if settings.HalfOpenProbes <= 0 {
+			settings.HalfOpenProbes = 1
+		}
+		a.breakers = map[string]*breaker{
+			BreakerSpay:    {name: BreakerSpay, settings: settings},
+			BreakerRequery: {name: BreakerRequery, settings: settings},
+		}
+	}
+}
+
+// CircuitState returns the state of the named breaker; without
+// WithCircuitBreaker every breaker is closed.
+func (a *Api) CircuitState(name string) CircuitState {
+	b, ok := a.breakers[name]
+	if !ok {
+		return CircuitClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.current(time.Now())
+}
+
+// allowRequest asks the named breaker to admit a request. The returned func
+// must be called with the request's outcome.
+func (a *Api) allowRequest(ctx context.Context, name string) (func(failed bool), error) {
+	b, ok := a.breakers[name]
+	if !ok {
+		return func(bool) {}, nil
+	}
+	done, err := b.allow()
+	if err != nil {
+		return nil, err
+	}
+	return func(failed bool) {
+		// a caller giving up says nothing about Spay's health
+		if ctx.Err() != nil {
+			done(outcomeIgnored)
+			return
+		}
+		if failed {
+			done(outcomeFailure)
+		} else {
+			done(outcomeSuccess)
+		}
+	}, nil
+}
+
+type outcome int
+
+const (
+	outcomeSuccess outcome = iota
+	outcomeFailure
+	outcomeIgnored
+)
+
+const breakerBuckets = 10
+
+type breakerBucket struct {
+	start    time.Time
+	total    int
+	failures int
+}
+
+type breaker struct {
+	name     string
+	settings BreakerSettings
+
+	mu        sync.Mutex
+	state     CircuitState
+	openedAt  time.Time
+	buckets   [breakerBuckets]breakerBucket
+	probes    int
+	successes int
+	// generation changes with every state change so outcomes of requests
+	// admitted under an earlier state are dropped
+	generation uint64
+}
+
+// current moves an open breaker to half-open once OpenFor has passed.
+func (b *breaker) current(now time.Time) CircuitState {
+	if b.state == CircuitOpen && now.Sub(b.openedAt) >= b.settings.OpenFor {
+		b.setState(CircuitHalfOpen, now)
+	}
+	return b.state
+}
+
+func (b *breaker) allow() (func(outcome), error) {
+	b.mu.Lock()
+	now := time.Now()
+	before := b.state
+	state := b.current(now)
+	generation := b.generation
+	var err error
+	switch state {
+	case CircuitOpen:
+		err = fmt.Errorf("%w: %s", ErrCircuitOpen, b.name)
+	case CircuitHalfOpen:
+		if b.probes >= b.settings.HalfOpenProbes {
+			err = fmt.Errorf("%w: %s is probing", ErrCircuitOpen, b.name)
+		} else {
+			b.probes++
+		}
+	}
+	b.mu.Unlock()
+	b.notify(before, state)
+	if err != nil {
+		return nil, err
+	}
+
+	var once sync.Once
+	return func(o outcome) {
+		once.Do(func() { b.record(generation, o) })
+	}, nil
+}
+
+func (b *breaker) record(generation uint64, o outcome) {
+	b.mu.Lock()
+	now := time.Now()
+	before := b.state
+	if generation != b.generation {
+		b.mu.Unlock()
+		return
+	}
+
+	switch b.state {
+	case CircuitHalfOpen:
+		b.probes--
+		switch o {
+		case outcomeFailure:
+			b.setState(CircuitOpen, now)
+		case outcomeSuccess:
+			b.successes++
+			if b.successes >= b.settings.HalfOpenProbes {
+				b.setState(CircuitClosed, now)
+			}
+		}
+	case CircuitClosed:
+		if o == outcomeIgnored {
+			break
+		}
+		bucket := b.bucket(now)
+		bucket.total++
+		if o == outcomeFailure {
+			bucket.failures++
+		}
+		total, failures := b.counts(now)
+		if total >= b.settings.MinRequests && float64(failures) >= b.settings.FailureRate*float64(total) {
+			b.setState(CircuitOpen, now)
+		}
+	}
+	after := b.state
+	b.mu.Unlock()
+	b.notify(before, after)
+}
+
+func (b *breaker) bucketWidth() time.Duration {
+	return b.settings.Window / breakerBuckets
+}
+
+func (b *breaker) bucket(now time.Time) *breakerBucket {
+	width := b.bucketWidth()
+	start := now.Truncate(width)
+	bucket := &b.buckets[(start.UnixNano()/int64(width))%breakerBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = breakerBucket{start: start}
+	}
+	return bucket
+}
+
+func (b *breaker) counts(now time.Time) (total, failures int) {
+	for _, bucket := range b.buckets {
+		if now.Sub(bucket.start) < b.settings.Window {
+			total += bucket.total
+			failures += bucket.failures
+		}
+	}
+	return total, failures
+}
+
+func (b *breaker) setState(state CircuitState, now time.Time) {
+	b.state = state
+	b.generation++
+	b.probes = 0
+	b.successes = 0
+	if state == CircuitOpen {
+		b.openedAt = now
+	}
+	if state == CircuitClosed {
+		b.buckets = [breakerBuckets]breakerBucket{}
+	}
+}
+
+func (b *breaker) notify(from, to CircuitState) {
+	if from != to && b.settings.OnStateChange != nil {
+		b.settings.OnStateChange(b.name, from, to)
+	}
+}
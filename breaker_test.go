@@ -0,0 +1,151 @@
+package spay
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	var changes []string
+	b := &breaker{name: BreakerSpay, settings: BreakerSettings{
+		Window:         time.Minute,
+		MinRequests:    4,
+		FailureRate:    0.5,
+		OpenFor:        20 * time.Millisecond,
+		HalfOpenProbes: 1,
+		OnStateChange: func(name string, from, to CircuitState) {
+			changes = append(changes, from.String()+">"+to.String())
+		},
+	}}
+	request := func(o outcome) error {
+		done, err := b.allow()
+		if err == nil {
+			done(o)
+		}
+		return err
+	}
+	state := func() CircuitState {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return b.current(time.Now())
+	}
+
+	steps := []struct {
+		name    string
+		wait    time.Duration
+		outcome outcome
+		wantErr bool
+		want    CircuitState
+	}{
+		{name: "success", outcome: outcomeSuccess, want: CircuitClosed},
+		{name: "failure below min requests", outcome: outcomeFailure, want: CircuitClosed},
+		{name: "ignored does not count", outcome: outcomeIgnored, want: CircuitClosed},
+		{name: "second success", outcome: outcomeSuccess, want: CircuitClosed},
+		{name: "failure reaching rate", outcome: outcomeFailure, want: CircuitOpen},
+		{name: "refused while open", outcome: outcomeSuccess, wantErr: true, want: CircuitOpen},
+		{name: "failed probe reopens", wait: 30 * time.Millisecond, outcome: outcomeFailure, want: CircuitOpen},
+		{name: "successful probe closes", wait: 30 * time.Millisecond, outcome: outcomeSuccess, want: CircuitClosed},
+		{name: "window cleared on close", outcome: outcomeFailure, want: CircuitClosed},
+	}
+	for _, step := range steps {
+		time.Sleep(step.wait)
+		err := request(step.outcome)
+		if (err != nil) != step.wantErr || (err != nil && !errors.Is(err, ErrCircuitOpen)) {
+			t.Fatalf("%s: allow error %v, want error %v", step.name, err, step.wantErr)
+		}
+		if got := state(); got != step.want {
+			t.Fatalf("%s: state %s, want %s", step.name, got, step.want)
+		}
+	}
+
+	want := []string{"closed>open", "open>half-open", "half-open>open", "open>half-open", "half-open>closed"}
+	if len(changes) != len(want) {
+		t.Fatalf("state changes %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("state changes %v, want %v", changes, want)
+		}
+	}
+}
+
+func TestBreakerHalfOpenAdmitsProbesOnly(t *testing.T) {
+	b := &breaker{name: BreakerSpay, settings: BreakerSettings{Window: time.Minute, MinRequests: 1, FailureRate: 1, OpenFor: time.Millisecond, HalfOpenProbes: 1}}
+	done, err := b.allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done(outcomeFailure)
+	time.Sleep(5 * time.Millisecond)
+
+	probe, err := b.allow()
+	if err != nil {
+		t.Fatalf("first probe refused: %v", err)
+	}
+	if _, err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second request while probing: got %v, want ErrCircuitOpen", err)
+	}
+	probe(outcomeSuccess)
+	if _, err := b.allow(); err != nil {
+		t.Fatalf("after successful probe: %v", err)
+	}
+}
+
+func TestBreakerIgnoresSpayRejections(t *testing.T) {
+	var calls atomic.Int64
+	api := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(400)
+		w.Write([]byte(`{"response":"x51","data":{"ResponseText":"Insufficient Funds"}}`))
+	}, WithCircuitBreaker(BreakerSettings{MinRequests: 2, FailureRate: 0.5}))
+
+	for i := 0; i < 5; i++ {
+		api.SterlingTransfer(&SterlingToSterlingTransferRequest{ToAcct: "0000000002", Amt: 100})
+	}
+	if got := api.CircuitState(BreakerSpay); got != CircuitClosed {
+		t.Errorf("after rejections the breaker is %s, want closed", got)
+	}
+	if calls.Load() != 5 {
+		t.Errorf("%d requests reached the server, want 5", calls.Load())
+	}
+}
+
+func TestIsRejected(t *testing.T) {
+	opErr := func(status int, code string, cause error) error {
+		return &OperationError{Operation: OpSterlingTransfer, HttpStatus: status, Code: code, Err: cause}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "4xx spay code", err: opErr(400, "x51", &ApiResponseErrorResult{Response: "x51"}), want: true},
+		{name: "5xx with code", err: opErr(500, "x51", &ApiResponseErrorResult{Response: "x51"}), want: false},
+		{name: "5xx debug", err: opErr(500, "", &ApiDebugErrorResult{ExceptionType: "System.Exception"}), want: false},
+		{name: "gateway", err: opErr(502, "", errors.New("unexpected error response")), want: false},
+		{name: "no response", err: opErr(0, "", errors.New("connection reset")), want: false},
+		{name: "final code", err: opErr(200, "51", fmt.Errorf("%w: no funds", ErrTransferNotCompleted)), want: true},
+		{name: "pending code", err: opErr(200, "09", fmt.Errorf("%w: in progress", ErrTransferNotCompleted)), want: false},
+		{name: "timeout code", err: opErr(200, "97", fmt.Errorf("%w: timeout", ErrTransferNotCompleted)), want: false},
+		{name: "empty code", err: opErr(200, "", fmt.Errorf("%w: ", ErrTransferNotCompleted)), want: false},
+		{name: "bare not completed", err: ErrTransferNotCompleted, want: false},
+		{name: "dry run", err: &DryRunError{}, want: true},
+		{name: "invalid argument", err: fmt.Errorf("%w: amount", ErrInvalidArgument), want: true},
+		{name: "limit", err: &LimitError{Limit: LimitDailyTotal}, want: true},
+		{name: "circuit open", err: fmt.Errorf("%w: spay", ErrCircuitOpen), want: true},
+		{name: "funds", err: &FundsError{}, want: true},
+		{name: "funds check", err: fmt.Errorf("%w: enquiry failed", ErrFundsCheck), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRejected(tt.err); got != tt.want {
+				t.Errorf("IsRejected(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
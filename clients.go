@@ -0,0 +1,126 @@
+package spay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrUnknownClient is returned by Registry lookups that match no client.
+var ErrUnknownClient = errors.New("unknown spay client")
+
+type sourceAccountKey struct{}
+
+// WithSourceAccount makes transfers and inflow queries made with ctx debit
+// or report on account instead of the source account given to NewApi. The
+// account must be one the Api's app ID may operate.
+func WithSourceAccount(ctx context.Context, account string) context.Context {
+	return context.WithValue(ctx, sourceAccountKey{}, account)
+}
+
+// OriginAccount returns the source account calls made with ctx use.
+func (a *Api) OriginAccount(ctx context.Context) string {
+	if account, _ := ctx.Value(sourceAccountKey{}).(string); account != "" {
+		return account
+	}
+	return a.config.FromAccount
+}
+
+// ClientConfig is what NewApi needs for one Sterling app: its credentials,
+// source account and options of its own, such as limits or metrics.
+type ClientConfig struct {
+	SharedVector          BitString
+	SharedKey             BitString
+	AppId                 int32
+	FromAccount           string
+	ShouldDecryptResponse bool
+	BaseUrl               string
+	Options               []Option
+}
+
+// Registry holds one Api per merchant or settlement account, so a process
+// can move money from many Sterling accounts and app IDs. Each client keeps
+// its own credentials, limit counters, funds checks and breakers.
+type Registry struct {
+	shared []Option
+
+	mu      sync.RWMutex
+	clients map[string]*Api
+}
+
+// NewRegistry returns an empty Registry. The shared options apply to every
+// client Add creates, before the client's own.
+func NewRegistry(shared ...Option) *Registry {
+	return &Registry{shared: shared, clients: map[string]*Api{}}
+}
+
+// Add creates a client from cfg and registers it under name.
+func (r *Registry) Add(name string, cfg ClientConfig) (*Api, error) {
+	opts := append(append([]Option{}, r.shared...), cfg.Options...)
+	api, err := NewApi(cfg.SharedVector, cfg.SharedKey, cfg.AppId, cfg.FromAccount, cfg.ShouldDecryptResponse, cfg.BaseUrl, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("client %s: %w", name, err)
+	}
+	if err := r.Register(name, api); err != nil {
+		return nil, err
+	}
+	return api, nil
+}
+
+// Register adds an existing Api under name.
+func (r *Registry) Register(name string, api *Api) error {
+	if name == "" || api == nil {
+		return fmt.Errorf("%w: client name and api are required", ErrInvalidArgument)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.clients[name]; ok {
+		return fmt.Errorf("%w: client %s is already registered", ErrInvalidArgument, name)
+	}
+	r.clients[name] = api
+	return nil
+}
+
+// Remove drops the client registered under name, if any.
+func (r *Registry) Remove(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.clients, name)
+}
+
+// Client returns the client registered under name.
+func (r *Registry) Client(name string) (*Api, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	api, ok := r.clients[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownClient, name)
+	}
+	return api, nil
+}
+
+// ForAccount returns the client whose source account is account.
+func (r *Registry) ForAccount(account string) (*Api, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, api := range r.clients {
+		if api.config.FromAccount == account {
+			return api, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no client for source account %s", ErrUnknownClient, account)
+}
+
+// Names lists the registered clients in order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.clients))
+	for name := range r.clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,137 @@
+package spay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func testClientConfig(account string) ClientConfig {
+	return ClientConfig{
+		SharedVector: bitString(testVector),
+		SharedKey:    bitString(testKey),
+		AppId:        1,
+		FromAccount:  account,
+		BaseUrl:      "http://spay.invalid",
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	merchant, err := r.Add("merchant", testClientConfig("0000000001"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Add("settlement", testClientConfig("0000000002")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Add("merchant", testClientConfig("0000000003")); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("adding a name twice: got %v, want ErrInvalidArgument", err)
+	}
+	if err := r.Register("", merchant); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("registering without a name: got %v, want ErrInvalidArgument", err)
+	}
+	if got, err := r.Client("merchant"); got != merchant || err != nil {
+		t.Errorf("Client(merchant) = %p, %v; want %p", got, err, merchant)
+	}
+	if got, err := r.ForAccount("0000000001"); got != merchant || err != nil {
+		t.Errorf("ForAccount(0000000001) = %p, %v; want %p", got, err, merchant)
+	}
+	if _, err := r.ForAccount("0000000009"); !errors.Is(err, ErrUnknownClient) {
+		t.Errorf("ForAccount of an unknown account: got %v, want ErrUnknownClient", err)
+	}
+	if names := r.Names(); !reflect.DeepEqual(names, []string{"merchant", "settlement"}) {
+		t.Errorf("Names = %v", names)
+	}
+
+	r.Remove("merchant")
+	if _, err := r.Client("merchant"); !errors.Is(err, ErrUnknownClient) {
+		t.Errorf("Client after Remove: got %v, want ErrUnknownClient", err)
+	}
+	if names := r.Names(); !reflect.DeepEqual(names, []string{"settlement"}) {
+		t.Errorf("Names after Remove = %v", names)
+	}
+}
+
+func TestRegistrySharedOptions(t *testing.T) {
+	// the client's own options come after the shared ones and win
+	r := NewRegistry(WithReferenceFormat(ReferenceFormat{MaxLength: 4}))
+	shared, err := r.Add("shared", testClientConfig("0000000001"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := testClientConfig("0000000002")
+	cfg.Options = []Option{WithReferenceFormat(ReferenceFormat{MaxLength: 40})}
+	own, err := r.Add("own", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shared.referenceFormat.MaxLength != 4 || own.referenceFormat.MaxLength != 40 {
+		t.Errorf("reference formats %+v and %+v, want the shared one and the client's own", shared.referenceFormat, own.referenceFormat)
+	}
+}
+
+func TestWithSourceAccount(t *testing.T) {
+	var payloads []map[string]any
+	capture := func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (*Reply, error) {
+			var payload map[string]any
+			json.Unmarshal(call.Payload, &payload)
+			payloads = append(payloads, payload)
+			return next(ctx, call)
+		}
+	}
+	api := newTestApi(t, reply(200, `{"response":"00","message":"ok"}`), WithInterceptors(capture))
+
+	ctx := WithSourceAccount(context.Background(), "0000000005")
+	if got := api.OriginAccount(ctx); got != "0000000005" {
+		t.Errorf("OriginAccount with an override = %s", got)
+	}
+	if got := api.OriginAccount(WithSourceAccount(context.Background(), "")); got != "0000000001" {
+		t.Errorf("OriginAccount with an empty override = %s, want the configured account", got)
+	}
+
+	for _, ctx := range []context.Context{context.Background(), ctx} {
+		if _, err := api.SterlingTransferContext(ctx, &SterlingToSterlingTransferRequest{ToAcct: "0000000002", Amt: 100}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var accounts []any
+	for _, payload := range payloads {
+		accounts = append(accounts, payload["frmacct"])
+	}
+	if want := []any{"0000000001", "0000000005"}; !reflect.DeepEqual(accounts, want) {
+		t.Errorf("transfers debited %v, want %v", accounts, want)
+	}
+}
+
+func TestWithSourceAccountRefusesFundsCheck(t *testing.T) {
+	api := newTestApi(t, reply(200, `{"response":"00","message":"ok"}`), WithFundsCheck(FundsPolicy{}))
+	ctx := WithSourceAccount(context.Background(), "0000000005")
+	_, err := api.SterlingTransferContext(ctx, &SterlingToSterlingTransferRequest{ToAcct: "0000000002", Amt: 100})
+	if !errors.Is(err, ErrFundsCheck) {
+		t.Errorf("got %v, want ErrFundsCheck", err)
+	}
+}
+
+func TestWithSourceAccountKeepsLimitsApart(t *testing.T) {
+	api := newTestApi(t, reply(200, `{"response":"00","message":"ok"}`), WithLimits(LimitPolicy{MaxDailyTotal: 100}, NewMemoryLimitStore()))
+	other := WithSourceAccount(context.Background(), "0000000005")
+	for i, step := range []struct {
+		ctx     context.Context
+		wantErr error
+	}{
+		{ctx: context.Background()},
+		{ctx: other},
+		{ctx: context.Background(), wantErr: ErrLimitExceeded},
+		{ctx: other, wantErr: ErrLimitExceeded},
+	} {
+		_, err := api.SterlingTransferContext(step.ctx, &SterlingToSterlingTransferRequest{ToAcct: "0000000002", Amt: 100})
+		if !errors.Is(err, step.wantErr) {
+			t.Errorf("transfer %d: got %v, want %v", i, err, step.wantErr)
+		}
+	}
+}
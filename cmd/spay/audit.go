@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/akacokafor/spay"
+)
+
+func runAudit(args []string) error {
+	if len(args) < 1 || args[0] != "verify" {
+		return fmt.Errorf("usage: spay audit verify [-seq n -hash h] file")
+	}
+	fs := flag.NewFlagSet("spay audit verify", flag.ContinueOnError)
+	seq := fs.Uint64("seq", 0, "sequence number of the last entry, recorded outside the log")
+	hash := fs.String("hash", "", "hash of the entry given by -seq")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: spay audit verify [-seq n -hash h] file")
+	}
+	if (*seq == 0) != (*hash == "") {
+		return fmt.Errorf("-seq and -hash go together")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := spay.VerifyAuditLogHead(f, spay.AuditHead{Seq: *seq, Hash: *hash})
+	if err != nil {
+		return fmt.Errorf("%d entries verified before failure: %w", n, err)
+	}
+	fmt.Fprintf(os.Stdout, "%d entries verified\n", n)
+	return nil
+}
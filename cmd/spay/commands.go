@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/akacokafor/spay"
+)
+
+const dateLayout = "2006-01-02"
+
+func isSterling(bankCode string, api *spay.Api) bool {
+	return bankCode == "" || bankCode == spay.SterlingNipCode || bankCode == api.GetBankCode()
+}
+
+func runBanks(args []string) error {
+	fs, g := newFlagSet("banks")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	e, err := setup(g)
+	if err != nil {
+		return err
+	}
+	banks, err := e.api.ListBanksContext(e.ctx)
+	return e.result(banks, err)
+}
+
+func runNameEnquiry(args []string) error {
+	fs, g := newFlagSet("name-enquiry")
+	account := fs.String("account", "", "account number (NUBAN)")
+	bank := fs.String("bank", "", "destination bank code; empty for Sterling")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *account == "" {
+		return fmt.Errorf("-account is required")
+	}
+	e, err := setup(g)
+	if err != nil {
+		return err
+	}
+
+	if isSterling(*bank, e.api) {
+		result, err := e.api.SterlingNameEnquiryContext(e.ctx, *account)
+		return e.result(result, err)
+	}
+	result, err := e.api.OtherBanksNameEnquiryContext(e.ctx, *account, *bank)
+	return e.result(result, err)
+}
+
+func runTransfer(args []string) error {
+	fs, g := newFlagSet("transfer")
+	to := fs.String("to", "", "destination account number")
+	bank := fs.String("bank", "", "destination bank code; empty for Sterling")
+	amount := fs.Float64("amount", 0, "amount in naira")
+	remarks := fs.String("remarks", "", "narration")
+	paymentRef := fs.String("payment-ref", "", "payment reference (generated when empty)")
+	reference := fs.String("reference", "", "request reference (generated when empty)")
+	teller := fs.String("teller", "", "teller id")
+	location := fs.String("location", "", "transaction location as lat,long")
+	sessionID := fs.String("session-id", "", "name enquiry session id; skips the name enquiry when set with -beneficiary-name")
+	beneficiary := fs.String("beneficiary-name", "", "beneficiary name from a previous name enquiry")
+	yes := fs.Bool("yes", false, "do not ask for confirmation")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *to == "" || *amount <= 0 {
+		return fmt.Errorf("-to and a positive -amount are required")
+	}
+	e, err := setup(g)
+	if err != nil {
+		return err
+	}
+
+	if *reference == "" {
+		if *reference, err = e.api.NewReference(); err != nil {
+			return err
+		}
+	}
+	if *paymentRef == "" {
+		*paymentRef = *reference
+	}
+
+	if isSterling(*bank, e.api) {
+		if !g.dryRun && !*yes && !confirm(fmt.Sprintf("transfer %.2f from %s to Sterling account %s?", *amount, e.api.OriginAccount(e.ctx), *to)) {
+			return fmt.Errorf("aborted")
+		}
+		result, err := e.api.SterlingTransferContext(e.ctx, &spay.SterlingToSterlingTransferRequest{
+			ReferenceId:   *reference,
+			Translocation: *location,
+			PaymentRef:    *paymentRef,
+			Amt:           *amount,
+			ToAcct:        *to,
+			Remarks:       *remarks,
+			Tellerid:      *teller,
+		})
+		return e.result(result, err)
+	}
+
+	if *sessionID == "" || *beneficiary == "" {
+		enquiry, err := e.liveApi.OtherBanksNameEnquiryContext(e.ctx, *to, *bank)
+		if err != nil {
+			return fmt.Errorf("name enquiry: %w", err)
+		}
+		*sessionID = enquiry.SessionID
+		*beneficiary = enquiry.AccountName
+	}
+
+	quote, err := e.api.QuoteTransfer(*amount, *bank)
+	if err != nil {
+		return err
+	}
+	if !g.dryRun && !*yes && !confirm(fmt.Sprintf("transfer %.2f from %s to %s (%s) at bank %s? fee %.2f + VAT %.2f, total debit %.2f",
+		*amount, e.api.OriginAccount(e.ctx), *to, *beneficiary, *bank, quote.Fee, quote.VAT, quote.Total)) {
+		return fmt.Errorf("aborted")
+	}
+
+	result, err := e.api.InitiateInterBankTransferContext(e.ctx, &spay.InterBankTransferRequest{
+		Translocation:        *location,
+		PaymentReference:     *paymentRef,
+		Reference:            *reference,
+		ToAccount:            *to,
+		Amount:               fmt.Sprintf("%.2f", *amount),
+		DestinationBankCode:  *bank,
+		NEResponse:           *beneficiary,
+		BenefiName:           *beneficiary,
+		Tellerid:             *teller,
+		Remarks:              *remarks,
+		NameEnquirySessionID: *sessionID,
+	})
+	return e.result(result, err)
+}
+
+func runTransferStatus(args []string) error {
+	fs, g := newFlagSet("transfer-status")
+	sessionID := fs.String("session-id", "", "NIP session id")
+	date := fs.String("date", time.Now().In(spay.Lagos).Format(dateLayout), "transaction date (YYYY-MM-DD)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *sessionID == "" {
+		return fmt.Errorf("-session-id is required")
+	}
+	day, err := time.ParseInLocation(dateLayout, *date, spay.Lagos)
+	if err != nil {
+		return fmt.Errorf("-date: %w", err)
+	}
+	e, err := setup(g)
+	if err != nil {
+		return err
+	}
+	result, err := e.api.QueryInflowsBySessionIDContext(e.ctx, *sessionID, day)
+	if err != nil {
+		return e.result(nil, err)
+	}
+	return e.result(result.Content, nil)
+}
+
+func runBalance(args []string) error {
+	fs, g := newFlagSet("balance")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	e, err := setup(g)
+	if err != nil {
+		return err
+	}
+	result, err := e.api.BalanceEnquiryContext(e.ctx)
+	return e.result(result, err)
+}
+
+func runStatement(args []string) error {
+	fs, g := newFlagSet("statement")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	e, err := setup(g)
+	if err != nil {
+		return err
+	}
+	result, err := e.api.GetStatementContext(e.ctx)
+	return e.result(result, err)
+}
+
+func runInflows(args []string) error {
+	fs, g := newFlagSet("inflows")
+	today := time.Now().In(spay.Lagos).Format(dateLayout)
+	from := fs.String("from", today, "first day (YYYY-MM-DD)")
+	to := fs.String("to", "", "last day (YYYY-MM-DD), defaults to -from")
+	account := fs.String("account", "", "only inflows credited to this account")
+	sessionID := fs.String("session-id", "", "only inflows with this NIP session id")
+	resolveBanks := fs.Bool("resolve-banks", false, "resolve sender banks against the bank list")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	query := spay.InflowQuery{Account: *account, SessionID: *sessionID}
+	var err error
+	if query.From, err = time.ParseInLocation(dateLayout, *from, spay.Lagos); err != nil {
+		return fmt.Errorf("-from: %w", err)
+	}
+	if *to != "" {
+		if query.To, err = time.ParseInLocation(dateLayout, *to, spay.Lagos); err != nil {
+			return fmt.Errorf("-to: %w", err)
+		}
+	}
+
+	e, err := setup(g)
+	if err != nil {
+		return err
+	}
+	if *resolveBanks {
+		if query.Banks, err = e.liveApi.ListBanksContext(e.ctx); err != nil {
+			return fmt.Errorf("listing banks: %w", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(e.ctx, os.Interrupt)
+	defer stop()
+
+	inflows := []spay.Inflow{}
+	it := e.api.ListInflows(ctx, query)
+	for it.Next() {
+		inflows = append(inflows, it.Inflow())
+	}
+	return e.result(inflows, it.Err())
+}
+
+func confirm(prompt string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", prompt)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/akacokafor/spay"
+)
+
+// config holds everything needed to build an Api. It is read from a JSON
+// file, then SPAY_* environment variables, then command line flags, each
+// overriding the last. Keys are deliberately not accepted as flags so they
+// never end up in shell history or process listings.
+type config struct {
+	SharedKey       string `json:"shared_key"`
+	SharedVector    string `json:"shared_vector"`
+	AppId           int32  `json:"app_id"`
+	FromAccount     string `json:"from_account"`
+	BaseUrl         string `json:"base_url"`
+	DecryptResponse bool   `json:"decrypt_response"`
+	AuditLog        string `json:"audit_log"`
+	Timeout         string `json:"timeout"`
+	CaFile          string `json:"ca_file"`
+	ClientCert      string `json:"client_cert"`
+	ClientKey       string `json:"client_key"`
+	Proxy           string `json:"proxy"`
+	// FundsBuffer, when set, checks the balance before each transfer and
+	// keeps this much in the source account.
+	FundsBuffer *float64 `json:"funds_buffer"`
+}
+
+type globalOptions struct {
+	configPath string
+	output     string
+	dryRun     bool
+	verbose    bool
+	principal  string
+
+	appId           string
+	fromAccount     string
+	baseUrl         string
+	decryptResponse string
+}
+
+func addGlobalFlags(fs *flag.FlagSet, g *globalOptions) {
+	fs.StringVar(&g.configPath, "config", os.Getenv("SPAY_CONFIG"), "path to JSON config file (default ~/.config/spay/config.json)")
+	fs.StringVar(&g.output, "output", "table", "output format: table or json")
+	fs.BoolVar(&g.dryRun, "dry-run", false, "print the request payload instead of sending it")
+	fs.BoolVar(&g.verbose, "verbose", false, "log requests and responses to stderr")
+	fs.StringVar(&g.principal, "principal", os.Getenv("USER"), "who is running the command, recorded in the audit log")
+	fs.StringVar(&g.appId, "app-id", "", "Spay app id")
+	fs.StringVar(&g.fromAccount, "from-account", "", "source account number")
+	fs.StringVar(&g.baseUrl, "base-url", "", "Spay base url")
+	fs.StringVar(&g.decryptResponse, "decrypt-response", "", "decrypt Spay responses (true or false)")
+}
+
+func loadConfig(g *globalOptions) (config, error) {
+	cfg := config{BaseUrl: spay.ProdBaseUrl}
+
+	path := g.configPath
+	explicit := path != ""
+	if !explicit {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, ".config", "spay", "config.json")
+		}
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(data, &cfg); err != nil {
+				return cfg, fmt.Errorf("config file %s: %w", path, err)
+			}
+		case explicit || !errors.Is(err, os.ErrNotExist):
+			return cfg, fmt.Errorf("config file: %w", err)
+		}
+	}
+
+	if err := applyEnv(&cfg); err != nil {
+		return cfg, err
+	}
+
+	if err := applyFlags(&cfg, g); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+func applyEnv(cfg *config) error {
+	if v := os.Getenv("SPAY_SHARED_KEY"); v != "" {
+		cfg.SharedKey = v
+	}
+	if v := os.Getenv("SPAY_SHARED_VECTOR"); v != "" {
+		cfg.SharedVector = v
+	}
+	if v := os.Getenv("SPAY_FROM_ACCOUNT"); v != "" {
+		cfg.FromAccount = v
+	}
+	if v := os.Getenv("SPAY_BASE_URL"); v != "" {
+		cfg.BaseUrl = v
+	}
+	if v := os.Getenv("SPAY_AUDIT_LOG"); v != "" {
+		cfg.AuditLog = v
+	}
+	if v := os.Getenv("SPAY_TIMEOUT"); v != "" {
+		cfg.Timeout = v
+	}
+	if v := os.Getenv("SPAY_CA_FILE"); v != "" {
+		cfg.CaFile = v
+	}
+	if v := os.Getenv("SPAY_CLIENT_CERT"); v != "" {
+		cfg.ClientCert = v
+	}
+	if v := os.Getenv("SPAY_CLIENT_KEY"); v != "" {
+		cfg.ClientKey = v
+	}
+	if v := os.Getenv("SPAY_PROXY"); v != "" {
+		cfg.Proxy = v
+	}
+	if v := os.Getenv("SPAY_APP_ID"); v != "" {
+		appId, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return fmt.Errorf("SPAY_APP_ID: %w", err)
+		}
+		cfg.AppId = int32(appId)
+	}
+	if v := os.Getenv("SPAY_DECRYPT_RESPONSE"); v != "" {
+		decrypt, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("SPAY_DECRYPT_RESPONSE: %w", err)
+		}
+		cfg.DecryptResponse = decrypt
+	}
+	return nil
+}
+
+func applyFlags(cfg *config, g *globalOptions) error {
+	if g.fromAccount != "" {
+		cfg.FromAccount = g.fromAccount
+	}
+	if g.baseUrl != "" {
+		cfg.BaseUrl = g.baseUrl
+	}
+	if g.appId != "" {
+		appId, err := strconv.ParseInt(g.appId, 10, 32)
+		if err != nil {
+			return fmt.Errorf("-app-id: %w", err)
+		}
+		cfg.AppId = int32(appId)
+	}
+	if g.decryptResponse != "" {
+		decrypt, err := strconv.ParseBool(g.decryptResponse)
+		if err != nil {
+			return fmt.Errorf("-decrypt-response: %w", err)
+		}
+		cfg.DecryptResponse = decrypt
+	}
+	return nil
+}
+
+func (c config) newApi(opts ...spay.Option) (*spay.Api, error) {
+	if c.SharedKey == "" || c.SharedVector == "" {
+		return nil, fmt.Errorf("shared key and vector must be set in the config file or SPAY_SHARED_KEY/SPAY_SHARED_VECTOR")
+	}
+	return spay.NewApi(
+		spay.BitString(c.SharedVector),
+		spay.BitString(c.SharedKey),
+		c.AppId,
+		c.FromAccount,
+		c.DecryptResponse,
+		c.BaseUrl,
+		opts...,
+	)
+}
+
+// transport builds the HTTP settings from the config.
+func (c config) transport() (spay.TransportConfig, error) {
+	var t spay.TransportConfig
+	if c.Timeout != "" {
+		timeout, err := time.ParseDuration(c.Timeout)
+		if err != nil {
+			return t, fmt.Errorf("timeout: %w", err)
+		}
+		t.Timeout = timeout
+	}
+	if c.CaFile != "" {
+		pool, err := spay.LoadCertPool(c.CaFile)
+		if err != nil {
+			return t, err
+		}
+		t.RootCAs = pool
+	}
+	if c.ClientCert != "" || c.ClientKey != "" {
+		cert, err := spay.LoadClientCertificate(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return t, err
+		}
+		t.ClientCertificates = append(t.ClientCertificates, cert)
+	}
+	if c.Proxy != "" {
+		proxy, err := url.Parse(c.Proxy)
+		if err != nil {
+			return t, fmt.Errorf("proxy: %w", err)
+		}
+		t.ProxyURL = proxy
+	}
+	return t, nil
+}
+
+// keyMaterial decodes the configured shared key and vector.
+func (c config) keyMaterial(format spay.KeyFormat) (key, vector []byte, err error) {
+	if c.SharedKey == "" || c.SharedVector == "" {
+		return nil, nil, fmt.Errorf("shared key and vector must be set in the config file or SPAY_SHARED_KEY/SPAY_SHARED_VECTOR")
+	}
+	key, _, err = spay.ParseKeyMaterial(c.SharedKey, format)
+	if err != nil {
+		return nil, nil, fmt.Errorf("shared key: %w", err)
+	}
+	vector, _, err = spay.ParseKeyMaterial(c.SharedVector, format)
+	if err != nil {
+		return nil, nil, fmt.Errorf("shared vector: %w", err)
+	}
+	return key, vector, nil
+}
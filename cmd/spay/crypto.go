@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/des"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/akacokafor/spay"
+	"github.com/sirupsen/logrus"
+)
+
+var cryptoCommands = map[string]func(*config, *cryptoOptions) error{
+	"encrypt": runEncrypt,
+	"decrypt": runDecrypt,
+	"keyinfo": runKeyInfo,
+}
+
+type cryptoOptions struct {
+	format string
+	in     string
+	out    string
+	output string
+}
+
+// runCrypto works entirely offline: it only needs the shared key and vector
+// from the usual configuration sources, never the network.
+func runCrypto(args []string) error {
+	if len(args) < 1 || cryptoCommands[args[0]] == nil {
+		return fmt.Errorf("usage: spay crypto encrypt|decrypt|keyinfo [flags]")
+	}
+	name := args[0]
+
+	fs := flag.NewFlagSet("spay crypto "+name, flag.ContinueOnError)
+	g := &globalOptions{}
+	fs.StringVar(&g.configPath, "config", os.Getenv("SPAY_CONFIG"), "path to JSON config file (default ~/.config/spay/config.json)")
+	opts := &cryptoOptions{}
+	fs.StringVar(&opts.format, "key-format", string(spay.KeyFormatAuto), "key and vector encoding: auto, bits, hex or base64")
+	fs.StringVar(&opts.in, "in", "", "input file (default stdin)")
+	fs.StringVar(&opts.out, "out", "", "output file (default stdout)")
+	fs.StringVar(&opts.output, "output", "table", "keyinfo output format: table or json")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	logrus.SetLevel(logrus.WarnLevel)
+	cfg, err := loadConfig(g)
+	if err != nil {
+		return err
+	}
+	return cryptoCommands[name](&cfg, opts)
+}
+
+func runEncrypt(cfg *config, opts *cryptoOptions) error {
+	key, vector, err := cfg.keyMaterial(spay.KeyFormat(opts.format))
+	if err != nil {
+		return err
+	}
+	input, err := readInput(opts.in)
+	if err != nil {
+		return err
+	}
+	// the newline echo and most editors end input with is not part of the
+	// payload
+	encrypted, err := spay.TripleDESCBCEncrypt(strings.TrimRight(string(input), "\r\n"), key, vector)
+	if err != nil {
+		return err
+	}
+	return writeOutput(opts.out, encrypted+"\n")
+}
+
+func runDecrypt(cfg *config, opts *cryptoOptions) error {
+	key, vector, err := cfg.keyMaterial(spay.KeyFormat(opts.format))
+	if err != nil {
+		return err
+	}
+	input, err := readInput(opts.in)
+	if err != nil {
+		return err
+	}
+	decrypted, err := spay.TripleDESCBCDecryptUnpadded(strings.TrimSpace(string(input)), key, vector)
+	if err != nil {
+		return err
+	}
+	return writeOutput(opts.out, decrypted)
+}
+
+type keyInfo struct {
+	KeyFormat         string `json:"key_format"`
+	KeyLength         int    `json:"key_length"`
+	KeyFingerprint    string `json:"key_fingerprint"`
+	KeyParity         string `json:"key_parity"`
+	VectorFormat      string `json:"vector_format"`
+	VectorLength      int    `json:"vector_length"`
+	VectorFingerprint string `json:"vector_fingerprint"`
+	Usable            bool   `json:"usable"`
+	Problems          string `json:"problems,omitempty"`
+}
+
+// runKeyInfo describes the configured key without ever printing it.
+func runKeyInfo(cfg *config, opts *cryptoOptions) error {
+	key, keyFormat, err := spay.ParseKeyMaterial(cfg.SharedKey, spay.KeyFormat(opts.format))
+	if err != nil {
+		return fmt.Errorf("shared key: %w", err)
+	}
+	vector, vectorFormat, err := spay.ParseKeyMaterial(cfg.SharedVector, spay.KeyFormat(opts.format))
+	if err != nil {
+		return fmt.Errorf("shared vector: %w", err)
+	}
+
+	info := keyInfo{
+		KeyFormat:         string(keyFormat),
+		KeyLength:         len(key),
+		KeyFingerprint:    spay.KeyFingerprint(key),
+		KeyParity:         "ok",
+		VectorFormat:      string(vectorFormat),
+		VectorLength:      len(vector),
+		VectorFingerprint: spay.KeyFingerprint(vector),
+	}
+
+	var problems []string
+	if bad := spay.DESParityErrors(key); len(bad) > 0 {
+		info.KeyParity = fmt.Sprintf("even parity in bytes %v", bad)
+		problems = append(problems, "key parity")
+	}
+	if len(key) != 3*des.BlockSize {
+		problems = append(problems, fmt.Sprintf("key is %d bytes, 3DES needs 24", len(key)))
+	}
+	if len(vector) != des.BlockSize {
+		problems = append(problems, fmt.Sprintf("vector is %d bytes, CBC needs 8", len(vector)))
+	}
+	if _, err := des.NewTripleDESCipher(key); err != nil {
+		problems = append(problems, err.Error())
+	}
+	info.Usable = len(key) == 3*des.BlockSize && len(vector) == des.BlockSize
+	info.Problems = strings.Join(problems, "; ")
+
+	return render(os.Stdout, opts.output, info)
+}
+
+func readInput(path string) ([]byte, error) {
+	if path == "" || path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+func writeOutput(path, data string) error {
+	if path == "" || path == "-" {
+		_, err := io.WriteString(os.Stdout, data)
+		return err
+	}
+	return os.WriteFile(path, []byte(data), 0o600)
+}
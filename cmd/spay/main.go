@@ -0,0 +1,164 @@
+// Command spay is an operator tool for the Sterling Spay API.
+//
+//	spay <command> [flags]
+//
+// Run "spay help" for the list of commands. Configuration is read from
+// ~/.config/spay/config.json (or -config / SPAY_CONFIG), then SPAY_*
+// environment variables, then flags.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/akacokafor/spay"
+	"github.com/sirupsen/logrus"
+)
+
+type command struct {
+	summary string
+	run     func(args []string) error
+}
+
+var commands = map[string]command{
+	"banks":           {"list banks reachable through NIP", runBanks},
+	"name-enquiry":    {"look up the account name for a NUBAN", runNameEnquiry},
+	"payout":          {"validate and send a CSV of payouts, resumably (payout run file.csv)", runPayout},
+	"transfer":        {"send an intrabank or interbank transfer", runTransfer},
+	"transfer-status": {"requery a NIP transaction by session id", runTransferStatus},
+	"audit":           {"verify a hash-chained audit log (audit verify file)", runAudit},
+	"balance":         {"show the source account balance", runBalance},
+	"crypto":          {"encrypt, decrypt or inspect keys offline (encrypt|decrypt|keyinfo)", runCrypto},
+	"statement":       {"show the source account statement", runStatement},
+	"inflows":         {"list inflows over a date range", runInflows},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "--help" {
+		usage()
+		return
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "spay: unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(os.Args[2:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "spay %s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: spay <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	tw := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %s\t%s\n", name, commands[name].summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, `run "spay <command> -h" for command flags`)
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *globalOptions) {
+	fs := flag.NewFlagSet("spay "+name, flag.ContinueOnError)
+	g := &globalOptions{}
+	addGlobalFlags(fs, g)
+	return fs, g
+}
+
+// env is the per-invocation state shared by commands. api honours -dry-run;
+// liveApi never does and is used for read-only lookups a dry run still needs,
+// such as the name enquiry ahead of an interbank transfer.
+//
+// ctx carries the principal for audit entries and is never cancelled;
+// commands derive interruptible contexts from it where that is safe.
+type env struct {
+	ctx     context.Context
+	opts    *globalOptions
+	cfg     config
+	api     *spay.Api
+	liveApi *spay.Api
+}
+
+func setup(g *globalOptions) (*env, error) {
+	if g.verbose {
+		logrus.SetLevel(logrus.InfoLevel)
+	} else {
+		logrus.SetLevel(logrus.WarnLevel)
+	}
+
+	cfg, err := loadConfig(g)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := cfg.transport()
+	if err != nil {
+		return nil, err
+	}
+	opts := []spay.Option{spay.WithTransport(transport)}
+	if cfg.AuditLog != "" {
+		sink, err := spay.NewFileAuditSink(cfg.AuditLog)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, spay.WithAuditSink(sink))
+	}
+	if cfg.FundsBuffer != nil {
+		opts = append(opts, spay.WithFundsCheck(spay.FundsPolicy{Buffer: *cfg.FundsBuffer}))
+	}
+
+	liveApi, err := cfg.newApi(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	api := liveApi
+	if g.dryRun {
+		api, err = cfg.newApi(append(opts, spay.WithDryRun())...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := spay.WithPrincipal(context.Background(), g.principal)
+	return &env{ctx: ctx, opts: g, cfg: cfg, api: api, liveApi: liveApi}, nil
+}
+
+// result renders a command's outcome, turning a dry run into the printed
+// request rather than an error.
+func (e *env) result(v any, err error) error {
+	var dry *spay.DryRunError
+	if errors.As(err, &dry) {
+		return renderDryRun(os.Stdout, e.opts.output, e.cfg, dry)
+	}
+	if err != nil {
+		return err
+	}
+	return render(os.Stdout, e.opts.output, v)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/akacokafor/spay"
+)
+
+// render writes v as indented JSON or as a table. Tables are derived from
+// the JSON form so every result type renders without a bespoke printer:
+// slices of objects become one row per element, objects become key/value
+// rows with nested fields flattened using dots.
+func render(w io.Writer, format string, v any) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case "table":
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var generic any
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	switch val := generic.(type) {
+	case []any:
+		rows := make([]map[string]string, 0, len(val))
+		columns := map[string]bool{}
+		for _, item := range val {
+			row := map[string]string{}
+			flatten("", item, row)
+			for k := range row {
+				columns[k] = true
+			}
+			rows = append(rows, row)
+		}
+		headers := sortedKeys(columns)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(headers, "\t")))
+		for _, row := range rows {
+			cells := make([]string, 0, len(headers))
+			for _, h := range headers {
+				cells = append(cells, row[h])
+			}
+			fmt.Fprintln(tw, strings.Join(cells, "\t"))
+		}
+	default:
+		row := map[string]string{}
+		flatten("", val, row)
+		for _, k := range sortedKeys(row) {
+			fmt.Fprintf(tw, "%s\t%s\n", k, row[k])
+		}
+	}
+	return tw.Flush()
+}
+
+func flatten(prefix string, v any, out map[string]string) {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, item := range val {
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			flatten(key, item, out)
+		}
+	case nil:
+		out[prefix] = ""
+	case []any:
+		data, _ := json.Marshal(val)
+		out[prefix] = string(data)
+	default:
+		if prefix == "" {
+			prefix = "value"
+		}
+		out[prefix] = fmt.Sprint(val)
+	}
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type dryRunOutput struct {
+	Method    string `json:"method"`
+	Url       string `json:"url"`
+	Encrypted string `json:"encrypted,omitempty"`
+	Plaintext string `json:"plaintext"`
+}
+
+// renderDryRun prints what a dry run would have sent, decrypting Spay
+// payloads with the configured key so operators can check the plaintext.
+func renderDryRun(w io.Writer, format string, cfg config, dry *spay.DryRunError) error {
+	out := dryRunOutput{Method: dry.Method, Url: dry.Url, Plaintext: string(dry.Body)}
+	if dry.Encrypted {
+		out.Encrypted = string(dry.Body)
+		plaintext, err := decryptWithConfig(cfg, string(dry.Body))
+		if err != nil {
+			return fmt.Errorf("decrypting dry run payload: %w", err)
+		}
+		out.Plaintext = plaintext
+	}
+	return render(w, format, out)
+}
+
+func decryptWithConfig(cfg config, payload string) (string, error) {
+	key, vector, err := cfg.keyMaterial(spay.KeyFormatAuto)
+	if err != nil {
+		return "", err
+	}
+	return spay.TripleDESCBCDecryptUnpadded(payload, key, vector)
+}
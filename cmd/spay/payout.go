@@ -0,0 +1,507 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/akacokafor/spay"
+)
+
+// Payout row states. A row moves pending -> sending -> done|failed|unknown.
+// sending is persisted before the transfer is sent, so a row found in that
+// state after a crash may or may not have been paid and is treated as
+// unknown: it is never retried unless -retry-unknown is given.
+const (
+	payoutPending = "pending"
+	payoutSending = "sending"
+	payoutDone    = "done"
+	payoutFailed  = "failed"
+	payoutUnknown = "unknown"
+)
+
+var payoutColumns = []string{"account_number", "bank_code", "amount", "narration", "reference"}
+
+type payoutRow struct {
+	Line          int
+	Key           string
+	AccountNumber string
+	BankCode      string
+	Amount        float64
+	Narration     string
+	Reference     string
+
+	beneficiary string
+	sessionID   string
+}
+
+type payoutRowState struct {
+	Status       string    `json:"status"`
+	Reference    string    `json:"reference"`
+	Beneficiary  string    `json:"beneficiary,omitempty"`
+	ResponseCode string    `json:"response_code,omitempty"`
+	Message      string    `json:"message,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	HttpStatus   int       `json:"http_status,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type payoutState struct {
+	path string
+	Rows map[string]*payoutRowState `json:"rows"`
+}
+
+func runPayout(args []string) error {
+	if len(args) < 1 || args[0] != "run" {
+		return fmt.Errorf("usage: spay payout run [flags] file.csv")
+	}
+
+	fs, g := newFlagSet("payout run")
+	statePath := fs.String("state", "", "state file (default <file>.state.json)")
+	resultsPath := fs.String("results", "", "results CSV (default <file>.results.csv)")
+	yes := fs.Bool("yes", false, "do not ask for confirmation")
+	retryUnknown := fs.Bool("retry-unknown", false, "resend rows whose outcome is unknown; check transfer-status first")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: spay payout run [flags] file.csv")
+	}
+	path := fs.Arg(0)
+	if *statePath == "" {
+		*statePath = path + ".state.json"
+	}
+	if *resultsPath == "" {
+		*resultsPath = path + ".results.csv"
+	}
+
+	rows, err := readPayoutFile(path)
+	if err != nil {
+		return err
+	}
+
+	e, err := setup(g)
+	if err != nil {
+		return err
+	}
+
+	state, err := loadPayoutState(*statePath)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(e.ctx, os.Interrupt)
+	defer stop()
+
+	todo := payoutTodo(rows, state, *retryUnknown)
+
+	if err := payoutNameEnquiries(ctx, e, todo); err != nil {
+		return err
+	}
+
+	printPayoutSummary(os.Stdout, rows, todo, state)
+
+	if len(todo) == 0 {
+		return writePayoutResults(*resultsPath, rows, state)
+	}
+	if g.dryRun {
+		for _, row := range todo {
+			_, err := sendPayout(e.ctx, e.api, row)
+			var dry *spay.DryRunError
+			if !errors.As(err, &dry) {
+				return fmt.Errorf("line %d: expected a dry run, got %v", row.Line, err)
+			}
+			fmt.Fprintf(os.Stdout, "\nline %d:\n", row.Line)
+			if err := renderDryRun(os.Stdout, g.output, e.cfg, dry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if !*yes && !confirm(fmt.Sprintf("send %d transfers?", len(todo))) {
+		return fmt.Errorf("aborted")
+	}
+
+	for _, row := range todo {
+		if ctx.Err() != nil {
+			break
+		}
+		st := &payoutRowState{Status: payoutSending, Reference: row.Reference, Beneficiary: row.beneficiary, UpdatedAt: time.Now()}
+		state.Rows[row.Key] = st
+		if err := state.save(); err != nil {
+			return fmt.Errorf("saving state before line %d: %w", row.Line, err)
+		}
+
+		res, err := sendPayout(e.ctx, e.api, row)
+		st.record(res, err)
+		fmt.Fprintf(os.Stderr, "line %d: %s\n", row.Line, st.Status)
+
+		if err := state.save(); err != nil {
+			return fmt.Errorf("saving state after line %d: %w", row.Line, err)
+		}
+	}
+
+	if err := writePayoutResults(*resultsPath, rows, state); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("interrupted; run again to resume")
+	}
+	return nil
+}
+
+// payoutTodo picks the rows a run sends: new, pending and failed ones, and
+// with retryUnknown those that may have been paid. A failure recorded from
+// a 5xx or a pending code may have paid out, so it is moved to unknown.
+func payoutTodo(rows []*payoutRow, state *payoutState, retryUnknown bool) []*payoutRow {
+	var todo []*payoutRow
+	for _, row := range rows {
+		st := state.Rows[row.Key]
+		if st != nil && st.Status == payoutFailed && (st.HttpStatus >= 500 || (st.ResponseCode != "" && spay.IsPendingCode(st.ResponseCode))) {
+			st.Status = payoutUnknown
+		}
+		switch {
+		case st == nil, st.Status == payoutPending, st.Status == payoutFailed:
+			todo = append(todo, row)
+		case (st.Status == payoutUnknown || st.Status == payoutSending) && retryUnknown:
+			todo = append(todo, row)
+		}
+	}
+	return todo
+}
+
+// record moves a row out of sending according to the transfer's outcome.
+func (st *payoutRowState) record(res payoutResult, err error) {
+	st.UpdatedAt = time.Now()
+	switch {
+	case err == nil:
+		st.Status = payoutDone
+		st.ResponseCode = res.code
+		st.Message = res.message
+	case isDefinitiveFailure(err):
+		st.Status = payoutFailed
+		st.Error = err.Error()
+	default:
+		st.Status = payoutUnknown
+		st.Error = err.Error()
+	}
+	var opErr *spay.OperationError
+	if errors.As(err, &opErr) {
+		st.HttpStatus, st.ResponseCode = opErr.HttpStatus, opErr.Code
+	}
+}
+
+func readPayoutFile(path string) ([]*payoutRow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range payoutColumns[:3] {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %q; expected %s", name, strings.Join(payoutColumns, ","))
+		}
+	}
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var rows []*payoutRow
+	var problems []string
+	seen := map[string]int{}
+	references := map[string]int{}
+	for line := 2; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		row := &payoutRow{
+			Line:          line,
+			AccountNumber: field(record, "account_number"),
+			BankCode:      field(record, "bank_code"),
+			Narration:     field(record, "narration"),
+			Reference:     field(record, "reference"),
+		}
+
+		amount, err := parsePayoutAmount(field(record, "amount"))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("line %d: %v", line, err))
+		}
+		row.Amount = amount
+
+		bankCode := row.BankCode
+		if bankCode == "" || bankCode == spay.SterlingNipCode {
+			bankCode = "232"
+		}
+		if err := spay.ValidateNUBAN(row.AccountNumber, bankCode); err != nil {
+			problems = append(problems, fmt.Sprintf("line %d: %v", line, err))
+		}
+
+		// rows are keyed by content rather than line number, so fixing a bad row
+		// or reordering the file keeps the identity, and derived reference, of
+		// every other row stable across resumed runs
+		identity := strings.Join([]string{row.AccountNumber, row.BankCode, field(record, "amount"), row.Narration, row.Reference}, "|")
+		seen[identity]++
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d", identity, seen[identity])))
+		row.Key = hex.EncodeToString(sum[:])
+		if row.Reference == "" {
+			row.Reference = "PO" + strings.ToUpper(hex.EncodeToString(sum[:10]))
+		}
+		if prev, ok := references[row.Reference]; ok {
+			problems = append(problems, fmt.Sprintf("line %d: reference %s already used on line %d", line, row.Reference, prev))
+		}
+		references[row.Reference] = line
+
+		rows = append(rows, row)
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%d validation errors:\n  %s", len(problems), strings.Join(problems, "\n  "))
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no rows in %s", path)
+	}
+	return rows, nil
+}
+
+func parsePayoutAmount(val string) (float64, error) {
+	val = strings.ReplaceAll(val, ",", "")
+	amount, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return 0, fmt.Errorf("amount %q is not a number", val)
+	}
+	if amount <= 0 {
+		return 0, fmt.Errorf("amount %s must be positive", val)
+	}
+	if i := strings.IndexByte(val, '.'); i >= 0 && len(val)-i-1 > 2 {
+		return 0, fmt.Errorf("amount %s has more than 2 decimal places", val)
+	}
+	return amount, nil
+}
+
+func payoutNameEnquiries(ctx context.Context, e *env, rows []*payoutRow) error {
+	var problems []string
+	var banks spay.ListOfBankResponse
+	for _, row := range rows {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if isSterling(row.BankCode, e.liveApi) {
+			res, err := e.liveApi.SterlingNameEnquiryContext(ctx, row.AccountNumber)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("line %d: name enquiry: %v", row.Line, err))
+				continue
+			}
+			row.beneficiary = res.AccountName
+			continue
+		}
+
+		if banks == nil {
+			var err error
+			if banks, err = e.liveApi.ListBanksContext(ctx); err != nil {
+				return fmt.Errorf("listing banks: %w", err)
+			}
+		}
+		if _, ok := banks.Find(row.BankCode); !ok {
+			problems = append(problems, fmt.Sprintf("line %d: unknown bank code %s", row.Line, row.BankCode))
+			continue
+		}
+		res, err := e.liveApi.OtherBanksNameEnquiryContext(ctx, row.AccountNumber, row.BankCode)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("line %d: name enquiry: %v", row.Line, err))
+			continue
+		}
+		row.beneficiary = res.AccountName
+		row.sessionID = res.SessionID
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d name enquiry errors:\n  %s", len(problems), strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func printPayoutSummary(w io.Writer, rows, todo []*payoutRow, state *payoutState) {
+	pending := map[string]bool{}
+	for _, row := range todo {
+		pending[row.Key] = true
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LINE\tACCOUNT\tBANK\tBENEFICIARY\tAMOUNT\tREFERENCE\tSTATUS")
+	var total, toSend float64
+	for _, row := range rows {
+		status := payoutPending
+		if st := state.Rows[row.Key]; st != nil {
+			status = st.Status
+		}
+		if pending[row.Key] {
+			status = "to send"
+			toSend += row.Amount
+		}
+		total += row.Amount
+		beneficiary := row.beneficiary
+		if beneficiary == "" && state.Rows[row.Key] != nil {
+			beneficiary = state.Rows[row.Key].Beneficiary
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%.2f\t%s\t%s\n", row.Line, row.AccountNumber, row.BankCode, beneficiary, row.Amount, row.Reference, status)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\n%d rows totalling %.2f; %d to send totalling %.2f\n", len(rows), total, len(todo), toSend)
+}
+
+type payoutResult struct {
+	code    string
+	message string
+}
+
+// sendPayout is given the uncancellable base context: an interrupt stops the
+// run between rows, never in the middle of a transfer.
+func sendPayout(ctx context.Context, api *spay.Api, row *payoutRow) (payoutResult, error) {
+	if isSterling(row.BankCode, api) {
+		res, err := api.SterlingTransferContext(ctx, &spay.SterlingToSterlingTransferRequest{
+			ReferenceId: row.Reference,
+			PaymentRef:  row.Reference,
+			Amt:         row.Amount,
+			ToAcct:      row.AccountNumber,
+			Remarks:     row.Narration,
+		})
+		if err != nil {
+			return payoutResult{}, err
+		}
+		return payoutResult{code: res.Response, message: res.Message}, nil
+	}
+
+	res, err := api.InitiateInterBankTransferContext(ctx, &spay.InterBankTransferRequest{
+		PaymentReference:     row.Reference,
+		Reference:            row.Reference,
+		ToAccount:            row.AccountNumber,
+		Amount:               fmt.Sprintf("%.2f", row.Amount),
+		DestinationBankCode:  row.BankCode,
+		NEResponse:           row.beneficiary,
+		BenefiName:           row.beneficiary,
+		Remarks:              row.Narration,
+		NameEnquirySessionID: row.sessionID,
+	})
+	if err != nil {
+		return payoutResult{}, err
+	}
+	return payoutResult{code: res.Response, message: res.Message}, nil
+}
+
+// isDefinitiveFailure reports whether a transfer was rejected or never sent,
+// so resuming may send it again. Anything else, such as a timeout, a 5xx or
+// a pending NIP code, may have been applied and is left for an operator to
+// check.
+func isDefinitiveFailure(err error) bool {
+	return spay.IsRejected(err)
+}
+
+func loadPayoutState(path string) (*payoutState, error) {
+	state := &payoutState{path: path, Rows: map[string]*payoutRowState{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("state file %s: %w", path, err)
+	}
+	if state.Rows == nil {
+		state.Rows = map[string]*payoutRowState{}
+	}
+	return state, nil
+}
+
+// save writes the state through a temporary file and rename so a crash
+// mid-write never leaves a truncated state file behind.
+func (s *payoutState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func writePayoutResults(path string, rows []*payoutRow, state *payoutState) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write(append(append([]string{}, payoutColumns...), "beneficiary", "status", "response_code", "message", "error"))
+	for _, row := range rows {
+		st := state.Rows[row.Key]
+		if st == nil {
+			st = &payoutRowState{Status: payoutPending}
+		}
+		beneficiary := st.Beneficiary
+		if beneficiary == "" {
+			beneficiary = row.beneficiary
+		}
+		w.Write([]string{
+			row.AccountNumber,
+			row.BankCode,
+			fmt.Sprintf("%.2f", row.Amount),
+			row.Narration,
+			row.Reference,
+			beneficiary,
+			st.Status,
+			st.ResponseCode,
+			st.Message,
+			st.Error,
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/akacokafor/spay"
+)
+
+// sterlingAccount returns a Sterling NUBAN with the given 9-digit serial.
+func sterlingAccount(t *testing.T, serial string) string {
+	t.Helper()
+	for d := 0; d < 10; d++ {
+		account := fmt.Sprintf("%s%d", serial, d)
+		if spay.ValidateNUBAN(account, "232") == nil {
+			return account
+		}
+	}
+	t.Fatalf("no check digit for %s", serial)
+	return ""
+}
+
+func writePayoutFile(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "payout.csv")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadPayoutFile(t *testing.T) {
+	sterling := sterlingAccount(t, "000000001")
+	path := writePayoutFile(t,
+		"Account_Number,bank_code,amount,narration,reference",
+		sterling+",,\"1,500.00\",rent,",
+		"0123456789,000013,250,fees,INV-7",
+		sterling+",,\"1,500.00\",rent,",
+	)
+	rows, err := readPayoutFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0].Amount != 1500 || rows[1].Reference != "INV-7" || rows[1].Line != 3 {
+		t.Fatalf("rows %+v", rows)
+	}
+	// identical rows are kept apart by occurrence
+	if rows[0].Key == rows[2].Key || rows[0].Reference == rows[2].Reference || !strings.HasPrefix(rows[0].Reference, "PO") {
+		t.Errorf("duplicate rows share key or reference: %+v, %+v", rows[0], rows[2])
+	}
+
+	// fixing or moving another row keeps a row's key and reference
+	moved := writePayoutFile(t,
+		"account_number,bank_code,amount,narration",
+		"0123456789,000013,300,fees",
+		sterling+",,\"1,500.00\",rent",
+	)
+	again, err := readPayoutFile(moved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again[1].Key != rows[0].Key || again[1].Reference != rows[0].Reference {
+		t.Errorf("row moved from line 2 to 3 changed identity: %+v, was %+v", again[1], rows[0])
+	}
+}
+
+func TestReadPayoutFileProblems(t *testing.T) {
+	sterling := sterlingAccount(t, "000000001")
+	tests := []struct {
+		name  string
+		lines []string
+		want  string
+	}{
+		{name: "missing column", lines: []string{"account_number,amount", sterling + ",1"}, want: `missing column "bank_code"`},
+		{name: "no rows", lines: []string{"account_number,bank_code,amount"}, want: "no rows"},
+		{name: "bad amount", lines: []string{"account_number,bank_code,amount", sterling + ",,N100"}, want: "not a number"},
+		{name: "negative amount", lines: []string{"account_number,bank_code,amount", sterling + ",,-1"}, want: "must be positive"},
+		{name: "fractions of a kobo", lines: []string{"account_number,bank_code,amount", sterling + ",,1.005"}, want: "more than 2 decimal places"},
+		{name: "bad check digit", lines: []string{"account_number,bank_code,amount", "0000000019,,1"}, want: "NUBAN check"},
+		{name: "short account", lines: []string{"account_number,bank_code,amount", "12345,000013,1"}, want: "not 10 digits"},
+		{name: "reused reference", lines: []string{
+			"account_number,bank_code,amount,narration,reference",
+			"0123456789,000013,1,a,INV-1",
+			"0123456789,000013,2,b,INV-1",
+		}, want: "already used on line 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readPayoutFile(writePayoutFile(t, tt.lines...))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPayoutTodo(t *testing.T) {
+	tests := []struct {
+		name         string
+		state        *payoutRowState
+		retryUnknown bool
+		wantSent     bool
+		wantStatus   string
+	}{
+		{name: "new", wantSent: true},
+		{name: "pending", state: &payoutRowState{Status: payoutPending}, wantSent: true, wantStatus: payoutPending},
+		{name: "rejected", state: &payoutRowState{Status: payoutFailed, HttpStatus: 400, ResponseCode: "x51"}, wantSent: true, wantStatus: payoutFailed},
+		{name: "declined", state: &payoutRowState{Status: payoutFailed, HttpStatus: 200, ResponseCode: "51"}, wantSent: true, wantStatus: payoutFailed},
+		{name: "done", state: &payoutRowState{Status: payoutDone}, wantStatus: payoutDone},
+		{name: "done with retry", state: &payoutRowState{Status: payoutDone}, retryUnknown: true, wantStatus: payoutDone},
+		{name: "unknown", state: &payoutRowState{Status: payoutUnknown}, wantStatus: payoutUnknown},
+		{name: "unknown with retry", state: &payoutRowState{Status: payoutUnknown}, retryUnknown: true, wantSent: true, wantStatus: payoutUnknown},
+		{name: "crashed while sending", state: &payoutRowState{Status: payoutSending}, wantStatus: payoutSending},
+		{name: "crashed while sending with retry", state: &payoutRowState{Status: payoutSending}, retryUnknown: true, wantSent: true, wantStatus: payoutSending},
+		{name: "failed with a 5xx", state: &payoutRowState{Status: payoutFailed, HttpStatus: 502}, wantStatus: payoutUnknown},
+		{name: "failed with a pending code", state: &payoutRowState{Status: payoutFailed, HttpStatus: 200, ResponseCode: "09"}, wantStatus: payoutUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := &payoutRow{Key: "k"}
+			state := &payoutState{Rows: map[string]*payoutRowState{}}
+			if tt.state != nil {
+				state.Rows["k"] = tt.state
+			}
+			todo := payoutTodo([]*payoutRow{row}, state, tt.retryUnknown)
+			if sent := len(todo) == 1; sent != tt.wantSent {
+				t.Errorf("sent %v, want %v", sent, tt.wantSent)
+			}
+			if tt.state != nil && tt.state.Status != tt.wantStatus {
+				t.Errorf("status %s, want %s", tt.state.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestPayoutRowStateRecord(t *testing.T) {
+	opErr := func(status int, code string, cause error) error {
+		return &spay.OperationError{Operation: spay.OpSterlingTransfer, HttpStatus: status, Code: code, Err: cause}
+	}
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus string
+		wantCode   string
+		wantHttp   int
+	}{
+		{name: "sent", wantStatus: payoutDone, wantCode: "00"},
+		{name: "rejected", err: opErr(400, "x51", &spay.ApiResponseErrorResult{Response: "x51"}), wantStatus: payoutFailed, wantCode: "x51", wantHttp: 400},
+		{name: "declined", err: opErr(200, "51", fmt.Errorf("%w: no funds", spay.ErrTransferNotCompleted)), wantStatus: payoutFailed, wantCode: "51", wantHttp: 200},
+		{name: "pending", err: opErr(200, "09", fmt.Errorf("%w: processing", spay.ErrTransferNotCompleted)), wantStatus: payoutUnknown, wantCode: "09", wantHttp: 200},
+		{name: "bad gateway", err: opErr(502, "", errors.New("unexpected error response")), wantStatus: payoutUnknown, wantHttp: 502},
+		{name: "timeout", err: opErr(0, "", fmt.Errorf("spay response: %w", os.ErrDeadlineExceeded)), wantStatus: payoutUnknown},
+		{name: "never sent", err: fmt.Errorf("%w: amount", spay.ErrInvalidArgument), wantStatus: payoutFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &payoutRowState{Status: payoutSending}
+			st.record(payoutResult{code: "00", message: "ok"}, tt.err)
+			if st.Status != tt.wantStatus || st.ResponseCode != tt.wantCode || st.HttpStatus != tt.wantHttp {
+				t.Errorf("state %+v, want %s with code %q and status %d", st, tt.wantStatus, tt.wantCode, tt.wantHttp)
+			}
+			if (tt.err == nil) != (st.Error == "") || st.UpdatedAt.IsZero() {
+				t.Errorf("state %+v for error %v", st, tt.err)
+			}
+		})
+	}
+}
+
+func TestPayoutStateFiles(t *testing.T) {
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "payout.csv.state.json")
+
+	state, err := loadPayoutState(statePath)
+	if err != nil || len(state.Rows) != 0 {
+		t.Fatalf("loading a missing state file = %+v, %v; want an empty state", state, err)
+	}
+	state.Rows["a"] = &payoutRowState{Status: payoutDone, Reference: "PO1", Beneficiary: "ADA OBI", ResponseCode: "00"}
+	state.Rows["b"] = &payoutRowState{Status: payoutUnknown, Reference: "PO2", Error: "bad gateway", HttpStatus: 502}
+	if err := state.save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadPayoutState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Rows, state.Rows) {
+		t.Errorf("loaded %+v, want %+v", loaded.Rows, state.Rows)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("%d files after save, want no temporary file left behind", len(entries))
+	}
+
+	if err := os.WriteFile(statePath, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadPayoutState(statePath); err == nil {
+		t.Error("loading a broken state file: want an error")
+	}
+
+	resultsPath := filepath.Join(dir, "payout.csv.results.csv")
+	rows := []*payoutRow{
+		{Key: "a", AccountNumber: "0123456789", BankCode: "000013", Amount: 10, Reference: "PO1"},
+		{Key: "b", AccountNumber: "0123456789", BankCode: "000013", Amount: 20, Reference: "PO2"},
+		{Key: "c", AccountNumber: "0123456789", BankCode: "000013", Amount: 30, Reference: "PO3", beneficiary: "EMEKA"},
+	}
+	if err := writePayoutResults(resultsPath, rows, state); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(resultsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][]string
+	for _, record := range records[1:] {
+		// reference, beneficiary, status, response_code, error
+		got = append(got, []string{record[4], record[5], record[6], record[7], record[9]})
+	}
+	want := [][]string{
+		{"PO1", "ADA OBI", payoutDone, "00", ""},
+		{"PO2", "", payoutUnknown, "", "bad gateway"},
+		{"PO3", "EMEKA", payoutPending, "", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("results %v, want %v", got, want)
+	}
+}
@@ -3,11 +3,84 @@ package spay
 import (
 	"crypto/cipher"
 	"crypto/des"
+	"crypto/sha256"
 	b64 "encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"math/bits"
+	"strings"
 )
 
+type KeyFormat string
+
+const (
+	KeyFormatAuto   KeyFormat = "auto"
+	KeyFormatBits   KeyFormat = "bits"
+	KeyFormatHex    KeyFormat = "hex"
+	KeyFormatBase64 KeyFormat = "base64"
+)
+
+// ParseKeyMaterial decodes a key or vector given as a BitString, hex or
+// base64. KeyFormatAuto tries them in that order and reports the format it
+// settled on.
+func ParseKeyMaterial(val string, format KeyFormat) ([]byte, KeyFormat, error) {
+	val = strings.TrimSpace(val)
+	if val == "" {
+		return nil, format, fmt.Errorf("%w: empty key material", ErrInvalidArgument)
+	}
+
+	switch format {
+	case KeyFormatBits:
+		out, err := BitString(val).AsByteSlice()
+		return out, format, err
+	case KeyFormatHex:
+		out, err := hex.DecodeString(val)
+		return out, format, err
+	case KeyFormatBase64:
+		out, err := b64.StdEncoding.DecodeString(val)
+		return out, format, err
+	case KeyFormatAuto, "":
+	default:
+		return nil, format, fmt.Errorf("%w: unknown key format %q", ErrInvalidArgument, format)
+	}
+
+	if len(val)%8 == 0 && strings.Trim(val, "01") == "" {
+		return ParseKeyMaterial(val, KeyFormatBits)
+	}
+	if out, err := hex.DecodeString(val); err == nil {
+		return out, KeyFormatHex, nil
+	}
+	if out, err := b64.StdEncoding.DecodeString(val); err == nil {
+		return out, KeyFormatBase64, nil
+	}
+	return nil, format, fmt.Errorf("%w: key material is not a bit string, hex or base64", ErrInvalidArgument)
+}
+
+// DESParityErrors returns the indexes of key bytes that do not have odd
+// parity. DES ignores the parity bits, so a non-empty result usually means
+// the key was transcribed or converted wrongly rather than that it is unusable.
+func DESParityErrors(key []byte) []int {
+	var out []int
+	for i, b := range key {
+		if bits.OnesCount8(b)%2 == 0 {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// KeyFingerprint identifies key material without revealing it: the first
+// eight bytes of its SHA-256, colon separated.
+func KeyFingerprint(key []byte) string {
+	sum := sha256.Sum256(key)
+	parts := make([]string, 8)
+	for i := range parts {
+		parts[i] = hex.EncodeToString(sum[i : i+1])
+	}
+	return strings.Join(parts, ":")
+}
+
 func TripleDESCBCEncrypt(input string, encryptionKey, encryptionvector []byte) (string, error) {
 	key := encryptionKey
 	iv := encryptionvector
@@ -30,26 +103,60 @@ func TripleDESCBCEncrypt(input string, encryptionKey, encryptionvector []byte) (
 	return b64.StdEncoding.EncodeToString(data), nil
 }
 
+// TripleDESCBCDecrypt decrypts a base64 payload and returns the plaintext
+// as is, block padding included. Use TripleDESCBCDecryptUnpadded for
+// payloads made by TripleDESCBCEncrypt or by Spay.
 func TripleDESCBCDecrypt(payload string, encryptionKey, encryptionvector []byte) (string, error) {
+	plaintext, err := tripleDESCBCDecrypt(payload, encryptionKey, encryptionvector)
+	return string(plaintext), err
+}
+
+// TripleDESCBCDecryptUnpadded is TripleDESCBCDecrypt with the PKCS#5
+// padding TripleDESCBCEncrypt adds stripped. Plaintext that does not end in
+// valid padding is returned whole.
+func TripleDESCBCDecryptUnpadded(payload string, encryptionKey, encryptionvector []byte) (string, error) {
+	plaintext, err := tripleDESCBCDecrypt(payload, encryptionKey, encryptionvector)
+	return string(unpad(plaintext)), err
+}
+
+func tripleDESCBCDecrypt(payload string, encryptionKey, encryptionvector []byte) ([]byte, error) {
 	key := encryptionKey
 	iv := encryptionvector
 	ciphertext, err := b64.StdEncoding.DecodeString(payload)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	block, err := des.NewTripleDESCipher(key)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if len(ciphertext) < des.BlockSize {
-		return "", errors.New("ciphertext too short")
+		return nil, errors.New("ciphertext too short")
 	}
 	if len(ciphertext)%des.BlockSize != 0 {
-		return "", fmt.Errorf("ciphertext is not a multiple of the block size")
+		return nil, fmt.Errorf("ciphertext is not a multiple of the block size")
 	}
 	mode := cipher.NewCBCDecrypter(block, iv)
 	plaintext := make([]byte, len(ciphertext))
 	mode.CryptBlocks(plaintext, ciphertext)
-	return string(plaintext), nil
+	return plaintext, nil
+}
+
+// unpad strips the PKCS#5 padding TripleDESCBCEncrypt adds. Input that does
+// not end in valid padding is returned unchanged.
+func unpad(data []byte) []byte {
+	if len(data) == 0 {
+		return data
+	}
+	pad := int(data[len(data)-1])
+	if pad < 1 || pad > des.BlockSize || pad > len(data) {
+		return data
+	}
+	for _, b := range data[len(data)-pad:] {
+		if int(b) != pad {
+			return data
+		}
+	}
+	return data[:len(data)-pad]
 }
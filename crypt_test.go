@@ -0,0 +1,48 @@
+package spay
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+var (
+	testKey    = []byte("0123456789abcdefghijklmn")
+	testVector = []byte("abcdefgh")
+)
+
+func bitString(b []byte) BitString {
+	var sb strings.Builder
+	for _, x := range b {
+		for i := 7; i >= 0; i-- {
+			if x&(1<<i) != 0 {
+				sb.WriteByte('1')
+			} else {
+				sb.WriteByte('0')
+			}
+		}
+	}
+	return BitString(sb.String())
+}
+
+// Api.decrypt used to run the encryption routine, so no encrypted reply
+// could be read.
+func TestApiDecryptReversesEncrypt(t *testing.T) {
+	api, err := NewApi(bitString(testVector), bitString(testKey), 1, "0000000001", true, StagingBaseUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, plain := range []string{"", "{}", `{"response":"00","message":"ok"}`, strings.Repeat("x", 64)} {
+		encrypted, err := api.encrypt(context.Background(), plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := api.decrypt(context.Background(), encrypted)
+		if err != nil {
+			t.Fatalf("decrypt(%q): %v", encrypted, err)
+		}
+		if got != plain {
+			t.Errorf("decrypt(encrypt(%q)) = %q", plain, got)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package spay
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -20,6 +23,10 @@ type BaseApiReq struct {
 	Translocation string `json:"Translocation"`
 }
 
+func (b BaseApiReq) reference() string {
+	return b.Referenceid
+}
+
 type ListOfBankResponse []BankResponse
 
 type BankResponse struct {
@@ -27,6 +34,55 @@ type BankResponse struct {
 	BankCode string `json:"BANKCODE"`
 }
 
+// Find looks a bank up by code or, failing that, by case-insensitive name.
+func (l ListOfBankResponse) Find(codeOrName string) (BankResponse, bool) {
+	codeOrName = strings.TrimSpace(codeOrName)
+	if codeOrName == "" {
+		return BankResponse{}, false
+	}
+	for _, bank := range l {
+		if bank.BankCode == codeOrName {
+			return bank, true
+		}
+	}
+	for _, bank := range l {
+		if strings.EqualFold(strings.TrimSpace(bank.BankName), codeOrName) {
+			return bank, true
+		}
+	}
+	return BankResponse{}, false
+}
+
+// StatementLine is one line of GetStatement, keyed by the field names
+// Sterling sends. The statement format is not documented, so values are
+// kept as text, numbers as they were written, rather than decoded into
+// guessed fields; reconcile.FromStatement reads the fields you name.
+type StatementLine map[string]string
+
+func (l *StatementLine) UnmarshalJSON(data []byte) error {
+	var fields map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return err
+	}
+	line := make(StatementLine, len(fields))
+	for name, value := range fields {
+		switch v := value.(type) {
+		case nil:
+		case string:
+			line[name] = v
+		case json.Number:
+			line[name] = v.String()
+		default:
+			raw, _ := json.Marshal(v)
+			line[name] = string(raw)
+		}
+	}
+	*l = line
+	return nil
+}
+
 type ApiOperationResponseData struct {
 	Response string `json:"response"`
 	Status   string `json:"status"`
@@ -51,8 +107,16 @@ type ApiResponseErrorResult struct {
 	Data         ApiResponseErrorResultData `json:"data"`
 }
 
+// Is matches Spay errors by response code, so errors.Is(err,
+// ErrInsufficientFunds) holds whatever message came with the code.
 func (a ApiResponseErrorResult) Is(target error) bool {
-	return target.Error() == a.Error()
+	switch t := target.(type) {
+	case *ApiResponseErrorResult:
+		return t != nil && t.Response != "" && t.Response == a.Response
+	case ApiResponseErrorResult:
+		return t.Response != "" && t.Response == a.Response
+	}
+	return false
 }
 
 func (a ApiResponseErrorResult) Error() string {
@@ -0,0 +1,125 @@
+package spay
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// OperationError describes a failed Spay or requery operation. Err is the
+// cause: a *ApiResponseErrorResult for 4xx responses carrying a Spay
+// response code, so errors.Is(err, ErrInsufficientFunds) and similar checks
+// see through it, a *ApiDebugErrorResult for 500 responses carrying a .NET
+// exception, or whatever else went wrong.
+type OperationError struct {
+	Operation   string
+	RequestType int
+	Reference   string
+	Method      string
+	Url         string
+	// HttpStatus is 0 when no response was received.
+	HttpStatus int
+	// Body is the raw response body.
+	Body []byte
+	// Code and Message are the Spay response code and text, when the
+	// response had them. They are filled in for 5xx responses too, for
+	// diagnosis only.
+	Code    string
+	Message string
+	// Response is the decoded Spay error body.
+	Response *ApiResponseErrorResult
+	// Debug is the exception Sterling returned with a 500 response.
+	Debug *ApiDebugErrorResult
+	Err   error
+}
+
+func (e *OperationError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(e.Operation)
+	if e.Reference != "" {
+		fmt.Fprintf(&sb, " (reference %s)", e.Reference)
+	}
+	if e.HttpStatus != 0 {
+		fmt.Fprintf(&sb, ": HTTP %d", e.HttpStatus)
+	}
+	if e.Err != nil {
+		fmt.Fprintf(&sb, ": %v", e.Err)
+	}
+	return sb.String()
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// newOperationError builds the error for call, filling in what reply and
+// err tell about the response.
+func newOperationError(call *Call, reply *Reply, err error) *OperationError {
+	opErr := &OperationError{
+		Operation:   call.Operation,
+		RequestType: call.RequestType,
+		Reference:   call.Reference,
+		Method:      call.Method,
+		Url:         call.Url,
+		Err:         err,
+	}
+	if reply != nil {
+		opErr.HttpStatus = reply.Status
+		opErr.Body = reply.Raw
+		var body ApiResponseErrorResult
+		if json.Unmarshal(reply.Raw, &body) == nil {
+			opErr.Code, opErr.Message = body.Response, body.Data.ResponseText
+			if opErr.Message == "" {
+				opErr.Message = body.Message
+			}
+		}
+	}
+	if apiErr, ok := err.(*ApiResponseErrorResult); ok {
+		opErr.Response = apiErr
+		opErr.Code = apiErr.Response
+		opErr.Message = apiErr.Data.ResponseText
+		if opErr.Message == "" {
+			opErr.Message = apiErr.Message
+		}
+	}
+	if debug, ok := err.(*ApiDebugErrorResult); ok {
+		opErr.Debug = debug
+		opErr.Message = debug.ExceptionMessage
+		if opErr.Message == "" {
+			opErr.Message = debug.Message
+		}
+	}
+	return opErr
+}
+
+// parseErrorBody decodes a non-2xx body: the exception shape ASP.NET returns
+// with 500 responses, or a Spay error result. Only a 4xx body carrying a
+// Spay response code is a *ApiResponseErrorResult, the one shape that means
+// Spay refused the request; a gateway's 502 page or a 5xx that merely
+// decodes as JSON leaves the outcome open.
+func parseErrorBody(status int, body []byte) error {
+	if status >= 500 {
+		var debug ApiDebugErrorResult
+		if err := json.Unmarshal(body, &debug); err == nil && (debug.ExceptionType != "" || debug.StackTrace != "" || debug.ExceptionMessage != "") {
+			return &debug
+		}
+	}
+
+	var errMsg ApiResponseErrorResult
+	if err := json.Unmarshal(body, &errMsg); err != nil || status >= 500 || errMsg.Response == "" {
+		return fmt.Errorf("unexpected error response: %s", bodyExcerpt(body))
+	}
+	return &errMsg
+}
+
+func bodyExcerpt(body []byte) string {
+	s := strings.TrimSpace(string(body))
+	if len(s) > 200 {
+		s = s[:200] + "..."
+	}
+	if s == "" {
+		return "empty body"
+	}
+	return strconv.Quote(s)
+}
@@ -0,0 +1,84 @@
+package spay
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseErrorBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		wantCode string
+		debug    bool
+	}{
+		{name: "spay rejection", status: 400, body: `{"response":"x51","data":{"ResponseText":"Insufficient Funds"}}`, wantCode: "x51"},
+		{name: "4xx without code", status: 400, body: `{"message":"The request is invalid."}`},
+		{name: "4xx html", status: 404, body: `<html>Not Found</html>`},
+		{name: "gateway json", status: 502, body: `{"message":"Bad gateway"}`},
+		{name: "5xx with code", status: 500, body: `{"response":"x51","message":"oops"}`},
+		{name: "gateway html", status: 504, body: `<html>Gateway Timeout</html>`},
+		{name: "empty 5xx", status: 503, body: ``},
+		{name: "debug", status: 500, body: `{"Message":"An error has occurred.","ExceptionMessage":"Object reference not set","ExceptionType":"System.NullReferenceException"}`, debug: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseErrorBody(tt.status, []byte(tt.body))
+			var apiErr *ApiResponseErrorResult
+			var debug *ApiDebugErrorResult
+			switch {
+			case tt.wantCode != "":
+				if !errors.As(err, &apiErr) || apiErr.Response != tt.wantCode {
+					t.Fatalf("got %T %v, want a Spay error with code %s", err, err, tt.wantCode)
+				}
+			case tt.debug:
+				if !errors.As(err, &debug) {
+					t.Fatalf("got %T %v, want a debug error", err, err)
+				}
+			default:
+				if errors.As(err, &apiErr) || errors.As(err, &debug) {
+					t.Fatalf("got %T %v, want a plain error", err, err)
+				}
+			}
+		})
+	}
+}
+
+func TestTransferErrorClassification(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		body         string
+		wantRejected bool
+		wantCode     string
+	}{
+		{name: "insufficient funds", status: 400, body: `{"response":"x51","data":{"ResponseText":"Insufficient Funds"}}`, wantRejected: true, wantCode: "x51"},
+		{name: "bad gateway", status: 502, body: `{"message":"Bad gateway"}`},
+		{name: "server error with code", status: 500, body: `{"response":"x51","message":"oops"}`, wantCode: "x51"},
+		{name: "pending", status: 200, body: `{"response":"09","message":"processing"}`, wantCode: "09"},
+		{name: "declined", status: 200, body: `{"response":"51","message":"no funds"}`, wantRejected: true, wantCode: "51"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestApi(t, reply(tt.status, tt.body))
+			_, err := api.SterlingTransfer(&SterlingToSterlingTransferRequest{ToAcct: "0000000002", Amt: 100})
+			var opErr *OperationError
+			if !errors.As(err, &opErr) {
+				t.Fatalf("got %T %v, want *OperationError", err, err)
+			}
+			if got := IsRejected(err); got != tt.wantRejected {
+				t.Errorf("IsRejected = %v, want %v (%v)", got, tt.wantRejected, err)
+			}
+			if opErr.Code != tt.wantCode {
+				t.Errorf("Code = %q, want %q", opErr.Code, tt.wantCode)
+			}
+			if want := tt.wantRejected && tt.wantCode == "x51"; errors.Is(err, ErrInsufficientFunds) != want {
+				t.Errorf("errors.Is(err, ErrInsufficientFunds) = %v, want %v", !want, want)
+			}
+			if opErr.HttpStatus != tt.status {
+				t.Errorf("HttpStatus = %d, want %d", opErr.HttpStatus, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package spay
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// SterlingNipCode is Sterling's NIP institution code. Transfers to it, to
+// the CBN code or with no bank code are intrabank.
+const SterlingNipCode = "000001"
+
+// FeeBand charges Fee on amounts up to and including UpTo. The last band of
+// a schedule has UpTo zero and covers everything above.
+type FeeBand struct {
+	UpTo float64
+	Fee  float64
+}
+
+// FeeSchedule is the NIP fee table in force from EffectiveFrom until the
+// next schedule starts. VATRate applies to the fee, not the principal.
+type FeeSchedule struct {
+	EffectiveFrom time.Time
+	Bands         []FeeBand
+	VATRate       float64
+}
+
+// DefaultFeeSchedules are the CBN NIP charges: 10, 25 and 50 naira for
+// transfers up to 5,000, up to 50,000 and above, with VAT at 7.5% since
+// February 2020.
+func DefaultFeeSchedules() []FeeSchedule {
+	bands := []FeeBand{{UpTo: 5000, Fee: 10}, {UpTo: 50000, Fee: 25}, {Fee: 50}}
+	return []FeeSchedule{
+		{EffectiveFrom: time.Date(2018, 1, 1, 0, 0, 0, 0, Lagos), Bands: bands, VATRate: 0.05},
+		{EffectiveFrom: time.Date(2020, 2, 1, 0, 0, 0, 0, Lagos), Bands: bands, VATRate: 0.075},
+	}
+}
+
+// WithFeeSchedules replaces the fee tables QuoteTransfer uses.
+func WithFeeSchedules(schedules ...FeeSchedule) Option {
+	return func(a *Api) {
+		a.feeSchedules = make([]FeeSchedule, len(schedules))
+		for i, schedule := range schedules {
+			bands := append([]FeeBand(nil), schedule.Bands...)
+			sort.SliceStable(bands, func(i, j int) bool {
+				if bands[i].UpTo == 0 || bands[j].UpTo == 0 {
+					return bands[j].UpTo == 0 && bands[i].UpTo != 0
+				}
+				return bands[i].UpTo < bands[j].UpTo
+			})
+			schedule.Bands = bands
+			a.feeSchedules[i] = schedule
+		}
+		sort.Slice(a.feeSchedules, func(i, j int) bool {
+			return a.feeSchedules[i].EffectiveFrom.Before(a.feeSchedules[j].EffectiveFrom)
+		})
+	}
+}
+
+// TransferQuote is what a transfer costs the source account. Total is
+// Principal plus Fee plus VAT, all rounded to kobo.
+type TransferQuote struct {
+	Route     string
+	Principal float64
+	Fee       float64
+	VAT       float64
+	Total     float64
+}
+
+// QuoteTransfer prices a transfer of amount to bankCode with the fees in
+// force now. Intrabank transfers are free.
+func (a *Api) QuoteTransfer(amount float64, bankCode string) (TransferQuote, error) {
+	return a.QuoteTransferAt(amount, bankCode, time.Now())
+}
+
+// QuoteTransferAt prices a transfer with the fees in force at t.
+func (a *Api) QuoteTransferAt(amount float64, bankCode string, t time.Time) (TransferQuote, error) {
+	if amount <= 0 || math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return TransferQuote{}, fmt.Errorf("%w: amount %v", ErrInvalidArgument, amount)
+	}
+	principal := roundKobo(amount)
+	if bankCode == "" || bankCode == sterlingBankCbnCode || bankCode == SterlingNipCode {
+		return TransferQuote{Route: RouteIntrabank, Principal: principal, Total: principal}, nil
+	}
+
+	schedule, err := a.feeSchedule(t)
+	if err != nil {
+		return TransferQuote{}, err
+	}
+	fee, err := schedule.fee(principal)
+	if err != nil {
+		return TransferQuote{}, err
+	}
+	vat := roundKobo(fee * schedule.VATRate)
+	return TransferQuote{
+		Route:     RouteInterbank,
+		Principal: principal,
+		Fee:       fee,
+		VAT:       vat,
+		Total:     roundKobo(principal + fee + vat),
+	}, nil
+}
+
+func (a *Api) feeSchedule(t time.Time) (FeeSchedule, error) {
+	for i := len(a.feeSchedules) - 1; i >= 0; i-- {
+		if !t.Before(a.feeSchedules[i].EffectiveFrom) {
+			return a.feeSchedules[i], nil
+		}
+	}
+	return FeeSchedule{}, fmt.Errorf("no fee schedule in force at %s", t.Format(time.RFC3339))
+}
+
+func (s FeeSchedule) fee(amount float64) (float64, error) {
+	for _, band := range s.Bands {
+		if band.UpTo == 0 || amount <= band.UpTo {
+			return band.Fee, nil
+		}
+	}
+	return 0, fmt.Errorf("fee schedule from %s has no band for %.2f", s.EffectiveFrom.Format("2006-01-02"), amount)
+}
+
+func roundKobo(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,90 @@
+package spay
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQuoteTransferAt(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, Lagos)
+	before2020 := time.Date(2019, 6, 1, 12, 0, 0, 0, Lagos)
+	tests := []struct {
+		name     string
+		amount   float64
+		bankCode string
+		at       time.Time
+		want     TransferQuote
+	}{
+		{name: "sterling nip code", amount: 100000, bankCode: SterlingNipCode, at: now,
+			want: TransferQuote{Route: RouteIntrabank, Principal: 100000, Total: 100000}},
+		{name: "sterling cbn code", amount: 100000, bankCode: "232", at: now,
+			want: TransferQuote{Route: RouteIntrabank, Principal: 100000, Total: 100000}},
+		{name: "no bank code", amount: 10, at: now,
+			want: TransferQuote{Route: RouteIntrabank, Principal: 10, Total: 10}},
+		{name: "lowest band", amount: 1, bankCode: "000014", at: now,
+			want: TransferQuote{Route: RouteInterbank, Principal: 1, Fee: 10, VAT: 0.75, Total: 11.75}},
+		{name: "top of lowest band", amount: 5000, bankCode: "000014", at: now,
+			want: TransferQuote{Route: RouteInterbank, Principal: 5000, Fee: 10, VAT: 0.75, Total: 5010.75}},
+		{name: "just above lowest band", amount: 5000.01, bankCode: "000014", at: now,
+			want: TransferQuote{Route: RouteInterbank, Principal: 5000.01, Fee: 25, VAT: 1.88, Total: 5026.89}},
+		{name: "top of middle band", amount: 50000, bankCode: "000014", at: now,
+			want: TransferQuote{Route: RouteInterbank, Principal: 50000, Fee: 25, VAT: 1.88, Total: 50026.88}},
+		{name: "open band", amount: 1000000, bankCode: "000014", at: now,
+			want: TransferQuote{Route: RouteInterbank, Principal: 1000000, Fee: 50, VAT: 3.75, Total: 1000053.75}},
+		{name: "vat before february 2020", amount: 1000000, bankCode: "000014", at: before2020,
+			want: TransferQuote{Route: RouteInterbank, Principal: 1000000, Fee: 50, VAT: 2.5, Total: 1000052.5}},
+		{name: "first day of 7.5% vat", amount: 1000000, bankCode: "000014", at: time.Date(2020, 2, 1, 0, 0, 0, 0, Lagos),
+			want: TransferQuote{Route: RouteInterbank, Principal: 1000000, Fee: 50, VAT: 3.75, Total: 1000053.75}},
+	}
+	api := newTestApi(t, reply(200, ""))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := api.QuoteTransferAt(tt.amount, tt.bankCode, tt.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("QuoteTransferAt(%v, %q) = %+v, want %+v", tt.amount, tt.bankCode, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuoteTransferErrors(t *testing.T) {
+	api := newTestApi(t, reply(200, ""))
+	for _, amount := range []float64{0, -5} {
+		if _, err := api.QuoteTransferAt(amount, "000014", time.Now()); !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("amount %v: got %v, want ErrInvalidArgument", amount, err)
+		}
+	}
+	if _, err := api.QuoteTransferAt(100, "000014", time.Date(2017, 1, 1, 0, 0, 0, 0, Lagos)); err == nil {
+		t.Error("quote before the first schedule: want an error")
+	}
+}
+
+func TestWithFeeSchedules(t *testing.T) {
+	// bands and schedules given out of order are sorted, open band last
+	api := newTestApi(t, reply(200, ""), WithFeeSchedules(
+		FeeSchedule{EffectiveFrom: time.Date(2025, 1, 1, 0, 0, 0, 0, Lagos), Bands: []FeeBand{{Fee: 100}, {UpTo: 1000, Fee: 20}}},
+		FeeSchedule{EffectiveFrom: time.Date(2024, 1, 1, 0, 0, 0, 0, Lagos), Bands: []FeeBand{{Fee: 5}}},
+	))
+	tests := []struct {
+		amount  float64
+		at      time.Time
+		wantFee float64
+	}{
+		{amount: 500, at: time.Date(2024, 6, 1, 0, 0, 0, 0, Lagos), wantFee: 5},
+		{amount: 500, at: time.Date(2025, 6, 1, 0, 0, 0, 0, Lagos), wantFee: 20},
+		{amount: 1000.01, at: time.Date(2025, 6, 1, 0, 0, 0, 0, Lagos), wantFee: 100},
+	}
+	for _, tt := range tests {
+		got, err := api.QuoteTransferAt(tt.amount, "000014", tt.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Fee != tt.wantFee || got.VAT != 0 {
+			t.Errorf("QuoteTransferAt(%v, %s) fee %v vat %v, want fee %v and no vat", tt.amount, tt.at.Format(time.DateOnly), got.Fee, got.VAT, tt.wantFee)
+		}
+	}
+}
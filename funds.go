@@ -0,0 +1,272 @@
+package spay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrFundsCheck is returned when the pre-flight balance enquiry fails. The
+// transfer was not sent.
+var ErrFundsCheck = errors.New("pre-flight funds check failed")
+
+// FundsError reports a transfer refused before sending because the source
+// account cannot cover it. It unwraps to ErrInsufficientFunds.
+type FundsError struct {
+	Available float64
+	Reserved  float64
+	Required  float64
+	Buffer    float64
+}
+
+func (e *FundsError) Error() string {
+	return fmt.Sprintf("insufficient funds: %.2f available, %.2f reserved by transfers in flight, %.2f required plus %.2f buffer",
+		e.Available, e.Reserved, e.Required, e.Buffer)
+}
+
+func (e *FundsError) Unwrap() error {
+	return ErrInsufficientFunds
+}
+
+// FundsPolicy configures the pre-flight funds check.
+//
+// Buffer is kept untouched in the source account. Fee returns what a
+// transfer costs on top of its amount and defaults to the fee and VAT of
+// QuoteTransfer. MaxAge is how long a balance enquiry is trusted, 30
+// seconds by default; within that window transfers are checked against the
+// same balance, less what earlier ones reserved.
+type FundsPolicy struct {
+	Buffer float64
+	Fee    func(amount float64, bankCode string) (float64, error)
+	MaxAge time.Duration
+}
+
+// WithFundsCheck makes every transfer check the source account balance
+// before it is sent.
+func WithFundsCheck(policy FundsPolicy) Option {
+	return func(a *Api) {
+		if policy.MaxAge <= 0 {
+			policy.MaxAge = 30 * time.Second
+		}
+		a.funds = &fundsChecker{policy: policy}
+	}
+}
+
+// AccountBalance is the source account balance as Spay reports it.
+type AccountBalance struct {
+	Available float64
+	Ledger    float64
+}
+
+// balanceRecord is one record of a balance enquiry. Spay's published
+// documentation gives request type 403 but no response shape; the upper
+// case names follow the other list operations (BANKNAME, BANKCODE) and
+// Sterling's account naming, so BalanceEnquiryContext fails on anything it
+// cannot read rather than report a balance it guessed.
+type balanceRecord struct {
+	AvailableBalance *flexAmount `json:"AVAILABLEBALANCE"`
+	LedgerBalance    *flexAmount `json:"LEDGERBALANCE"`
+	Balance          *flexAmount `json:"BALANCE"`
+}
+
+// flexAmount accepts amounts sent as JSON numbers or as strings, with or
+// without thousands separators. A blank string is an error, not zero.
+type flexAmount float64
+
+func (f *flexAmount) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var v float64
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		*f = flexAmount(v)
+		return nil
+	}
+	if strings.TrimSpace(s) == "" {
+		return errors.New("blank amount")
+	}
+	v, err := parseAmount(s)
+	if err != nil {
+		return err
+	}
+	*f = flexAmount(v)
+	return nil
+}
+
+func (a *Api) BalanceEnquiry() (*AccountBalance, error) {
+	return a.BalanceEnquiryContext(context.Background())
+}
+
+// BalanceEnquiryContext runs a balance enquiry for the source account and
+// decodes the balances from it. Accounts without a separate available
+// balance report BALANCE for both. A response with none of the balance
+// fields, or with one that is blank or not a number, is an error rather
+// than a zero balance; a null field counts as absent.
+func (a *Api) BalanceEnquiryContext(ctx context.Context) (*AccountBalance, error) {
+	ref, err := a.NewReference()
+	if err != nil {
+		return nil, err
+	}
+	req := ListBanksRequest{
+		BaseApiReq: BaseApiReq{
+			Referenceid:   ref,
+			RequestType:   opBalanceEnquiry.requestType,
+			Translocation: defaultLocation,
+		},
+	}
+	output, err := do(ctx, a, listSpec(opBalanceEnquiry), req)
+	if err != nil {
+		return nil, err
+	}
+
+	data := []byte(strings.TrimSpace(output.Data.Response))
+	var records []balanceRecord
+	if len(data) > 0 && data[0] == '{' {
+		records = make([]balanceRecord, 1)
+		err = a.decode(ctx, data, &records[0])
+	} else {
+		err = a.decode(ctx, data, &records)
+	}
+	if err == nil && len(records) == 0 {
+		err = errors.New("no balance in response")
+	}
+	var available, ledger *flexAmount
+	if err == nil {
+		r := records[0]
+		available, ledger = firstAmount(r.AvailableBalance, r.Balance), firstAmount(r.LedgerBalance, r.Balance, r.AvailableBalance)
+		if available == nil {
+			err = errors.New("no AVAILABLEBALANCE, LEDGERBALANCE or BALANCE in response")
+		}
+	}
+	if err != nil {
+		return nil, &OperationError{Operation: opBalanceEnquiry.name, RequestType: opBalanceEnquiry.requestType, Reference: req.Referenceid, Err: fmt.Errorf("decoding balance: %w", err)}
+	}
+	return &AccountBalance{Available: float64(*available), Ledger: float64(*ledger)}, nil
+}
+
+func firstAmount(amounts ...*flexAmount) *flexAmount {
+	for _, amount := range amounts {
+		if amount != nil {
+			return amount
+		}
+	}
+	return nil
+}
+
+// fundsChecker holds the last known balance and what transfers in flight
+// have reserved against it.
+type fundsChecker struct {
+	policy FundsPolicy
+
+	mu       sync.Mutex
+	balance  float64
+	fetched  time.Time
+	reserved float64
+	// fetching is closed when the enquiry in flight, if any, ends
+	fetching chan struct{}
+}
+
+// reserve checks that the source account covers amount plus fees and the
+// buffer, and holds that much until the returned settle func is called
+// with the transfer's outcome.
+func (f *fundsChecker) reserve(ctx context.Context, a *Api, amount float64, bankCode string) (func(error), error) {
+	// Spay only reports the balance of the account configured for the app
+	if account := a.OriginAccount(ctx); account != a.config.FromAccount {
+		return nil, fmt.Errorf("%w: no balance enquiry for source account %s", ErrFundsCheck, account)
+	}
+
+	fee := 0.0
+	var err error
+	if f.policy.Fee != nil {
+		fee, err = f.policy.Fee(amount, bankCode)
+	} else {
+		var quote TransferQuote
+		quote, err = a.QuoteTransfer(amount, bankCode)
+		fee = quote.Fee + quote.VAT
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFundsCheck, err)
+	}
+	required := roundKobo(amount + fee)
+
+	if err := f.lockFresh(ctx, a); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFundsCheck, err)
+	}
+	defer f.mu.Unlock()
+
+	if f.balance-f.reserved-required < f.policy.Buffer-0.005 {
+		return nil, &FundsError{Available: f.balance, Reserved: f.reserved, Required: required, Buffer: f.policy.Buffer}
+	}
+	f.reserved += required
+
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			f.reserved -= required
+			// anything but a definite rejection may have moved the money;
+			// a balance fetched meanwhile may count it twice, which only errs
+			// on the strict side until the next enquiry
+			if !IsRejected(err) {
+				f.balance -= required
+			}
+			// Sterling knows better: enquire again before the next transfer
+			var fundsErr *FundsError
+			if errors.Is(err, ErrInsufficientFunds) && !errors.As(err, &fundsErr) {
+				f.fetched = time.Time{}
+			}
+		})
+	}, nil
+}
+
+// lockFresh locks f.mu once the balance is no older than MaxAge, running
+// a balance enquiry when it is not. The enquiry runs without the lock so
+// settling transfers are not held up; concurrent callers wait for the one
+// in flight instead of starting their own. On error f.mu is not held.
+func (f *fundsChecker) lockFresh(ctx context.Context, a *Api) error {
+	for {
+		f.mu.Lock()
+		if time.Since(f.fetched) <= f.policy.MaxAge {
+			return nil
+		}
+		if wait := f.fetching; wait != nil {
+			f.mu.Unlock()
+			select {
+			case <-wait:
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		done := make(chan struct{})
+		f.fetching = done
+		f.mu.Unlock()
+
+		balance, err := a.BalanceEnquiryContext(ctx)
+
+		f.mu.Lock()
+		f.fetching = nil
+		close(done)
+		if err != nil {
+			f.mu.Unlock()
+			return err
+		}
+		f.balance, f.fetched = balance.Available, time.Now()
+		return nil
+	}
+}
+
+// checkFunds reserves a transfer against the source balance when
+// WithFundsCheck is set.
+func (a *Api) checkFunds(ctx context.Context, amount float64, bankCode string) (func(error), error) {
+	if a.funds == nil || a.dryRun {
+		return func(error) {}, nil
+	}
+	return a.funds.reserve(ctx, a, amount, bankCode)
+}
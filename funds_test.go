@@ -0,0 +1,176 @@
+package spay
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const balanceReply = `{"message":"ok","response":"00","data":{"status":"Successful","response":"[{\"AVAILABLEBALANCE\":\"1,000.00\"}]"}}`
+
+// fundsServer answers balance enquiries with balance and transfers with
+// status and body, counting the enquiries.
+func fundsServer(balance string, status int, body string, enquiries *atomic.Int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, opBalanceEnquiry.path) {
+			enquiries.Add(1)
+			// give concurrent transfers time to pile up behind the enquiry
+			time.Sleep(10 * time.Millisecond)
+			io.WriteString(w, balance)
+			return
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}
+}
+
+func TestBalanceEnquiry(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          string
+		wantAvailable float64
+		wantLedger    float64
+		wantErr       bool
+	}{
+		{name: "available only", data: `[{\"AVAILABLEBALANCE\":\"1,000.00\"}]`, wantAvailable: 1000, wantLedger: 1000},
+		{name: "available and ledger", data: `[{\"AVAILABLEBALANCE\":900,\"LEDGERBALANCE\":\"1,200.50\"}]`, wantAvailable: 900, wantLedger: 1200.5},
+		{name: "balance only", data: `{\"BALANCE\":\"250.00\"}`, wantAvailable: 250, wantLedger: 250},
+		{name: "zero balance", data: `[{\"AVAILABLEBALANCE\":\"0.00\"}]`},
+		{name: "null available falls back to balance", data: `[{\"AVAILABLEBALANCE\":null,\"BALANCE\":\"75\"}]`, wantAvailable: 75, wantLedger: 75},
+		{name: "no balance field", data: `[{\"ACCOUNTNAME\":\"ACME\"}]`, wantErr: true},
+		{name: "null balance", data: `[{\"AVAILABLEBALANCE\":null}]`, wantErr: true},
+		{name: "blank balance", data: `[{\"AVAILABLEBALANCE\":\"\"}]`, wantErr: true},
+		{name: "blank available with ledger", data: `[{\"AVAILABLEBALANCE\":\" \",\"LEDGERBALANCE\":\"1,200.50\"}]`, wantErr: true},
+		{name: "not a number", data: `[{\"AVAILABLEBALANCE\":\"N/A\"}]`, wantErr: true},
+		{name: "empty list", data: `[]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestApi(t, reply(200, `{"message":"ok","response":"00","data":{"status":"Successful","response":"`+tt.data+`"}}`))
+			got, err := api.BalanceEnquiry()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Available != tt.wantAvailable || got.Ledger != tt.wantLedger {
+				t.Errorf("got %+v, want available %v ledger %v", got, tt.wantAvailable, tt.wantLedger)
+			}
+		})
+	}
+}
+
+func TestFundsCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		// wantSecond is whether a second transfer of 600 is let through
+		// after the first one
+		wantSecond bool
+	}{
+		{name: "rejected gives the reservation back", status: 400, body: `{"response":"x05","data":{"ResponseText":"Do not honour"}}`, wantSecond: true},
+		{name: "bad gateway keeps it spent", status: 502, body: `{"message":"Bad gateway"}`},
+		{name: "pending keeps it spent", status: 200, body: `{"response":"09","message":"processing"}`},
+		{name: "sent keeps it spent", status: 200, body: `{"response":"00","message":"ok"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var enquiries atomic.Int64
+			api := newTestApi(t, fundsServer(balanceReply, tt.status, tt.body, &enquiries), WithFundsCheck(FundsPolicy{Buffer: 100}))
+
+			_, err := api.SterlingTransfer(&SterlingToSterlingTransferRequest{ToAcct: "0000000002", Amt: 600})
+			var fundsErr *FundsError
+			if errors.As(err, &fundsErr) {
+				t.Fatalf("first transfer refused: %v", err)
+			}
+			_, err = api.SterlingTransfer(&SterlingToSterlingTransferRequest{ToAcct: "0000000002", Amt: 600})
+			if refused := errors.As(err, &fundsErr); refused == tt.wantSecond {
+				t.Errorf("second transfer refused %v, want %v (%v)", refused, !tt.wantSecond, err)
+			}
+			if refused := errors.As(err, &fundsErr); refused && !errors.Is(err, ErrInsufficientFunds) {
+				t.Errorf("%v does not wrap ErrInsufficientFunds", err)
+			}
+			if enquiries.Load() != 1 {
+				t.Errorf("%d balance enquiries, want 1", enquiries.Load())
+			}
+		})
+	}
+}
+
+func TestFundsCheckBuffer(t *testing.T) {
+	var enquiries atomic.Int64
+	api := newTestApi(t, fundsServer(balanceReply, 200, `{"response":"00","message":"ok"}`, &enquiries), WithFundsCheck(FundsPolicy{Buffer: 100}))
+
+	_, err := api.SterlingTransfer(&SterlingToSterlingTransferRequest{ToAcct: "0000000002", Amt: 900.01})
+	var fundsErr *FundsError
+	if !errors.As(err, &fundsErr) || fundsErr.Available != 1000 || fundsErr.Buffer != 100 {
+		t.Fatalf("got %v, want a FundsError against 1000 available and a 100 buffer", err)
+	}
+	if _, err := api.SterlingTransfer(&SterlingToSterlingTransferRequest{ToAcct: "0000000002", Amt: 900}); err != nil {
+		t.Fatalf("transfer leaving exactly the buffer: %v", err)
+	}
+}
+
+func TestFundsCheckEnquiryFails(t *testing.T) {
+	for name, data := range map[string]string{
+		"no balance":    `[{\"ACCOUNTNAME\":\"ACME\"}]`,
+		"blank balance": `[{\"AVAILABLEBALANCE\":\"\"}]`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			var enquiries, transfers atomic.Int64
+			balance := `{"message":"ok","response":"00","data":{"status":"Successful","response":"` + data + `"}}`
+			server := fundsServer(balance, 200, `{"response":"00","message":"ok"}`, &enquiries)
+			api := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+				if !strings.HasSuffix(r.URL.Path, opBalanceEnquiry.path) {
+					transfers.Add(1)
+				}
+				server(w, r)
+			}, WithFundsCheck(FundsPolicy{}))
+
+			_, err := api.SterlingTransfer(&SterlingToSterlingTransferRequest{ToAcct: "0000000002", Amt: 1})
+			if !errors.Is(err, ErrFundsCheck) || !IsRejected(err) || transfers.Load() != 0 {
+				t.Fatalf("got %v with %d transfers sent, want a rejected ErrFundsCheck and none", err, transfers.Load())
+			}
+		})
+	}
+}
+
+func TestFundsCheckSharesEnquiry(t *testing.T) {
+	var enquiries atomic.Int64
+	api := newTestApi(t, fundsServer(balanceReply, 200, `{"response":"00","message":"ok"}`, &enquiries), WithFundsCheck(FundsPolicy{}))
+
+	var wg sync.WaitGroup
+	var refused atomic.Int64
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := api.SterlingTransferContext(context.Background(), &SterlingToSterlingTransferRequest{ToAcct: "0000000002", Amt: 200})
+			var fundsErr *FundsError
+			if errors.As(err, &fundsErr) {
+				refused.Add(1)
+			} else if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if enquiries.Load() != 1 {
+		t.Errorf("%d balance enquiries, want 1", enquiries.Load())
+	}
+	// 1000 covers five transfers of 200
+	if refused.Load() != 3 {
+		t.Errorf("%d transfers refused, want 3", refused.Load())
+	}
+}
@@ -0,0 +1,397 @@
+package spay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+const (
+	transactionByAccountUrl = "https://epayments.sterling.ng/NIPRequery/api/GetTransactionController/GetTransactionByAccount"
+	transactionStatusUrl    = "https://epayments.sterling.ng/NIPrequeryV2/api/v1.0/NIP/FetchTransactionStatus"
+	previousTransactionsUrl = "https://epayments.sterling.ng/NIPrequeryV2/api/v1.0/NIP/FetchPreviousTransactionsStatus"
+	requeryDateLayout       = "2006-01-02"
+)
+
+// Lagos is the zone Sterling posts transactions in, and the one daily limits,
+// statements and schedules are counted in. Lagos has no daylight saving, so
+// a fixed offset is a safe fallback when tzdata is missing.
+var Lagos = func() *time.Location {
+	loc, err := time.LoadLocation("Africa/Lagos")
+	if err != nil {
+		return time.FixedZone("WAT", 60*60)
+	}
+	return loc
+}()
+
+// datePostedLayouts are the Dateposted formats seen across the requery endpoints.
+var datePostedLayouts = []string{
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"1/2/2006 3:04:05 PM",
+	"02/01/2006 15:04:05",
+	"2006-01-02",
+}
+
+// Inflow is the canonical inflow record both requery response shapes
+// convert into.
+type Inflow struct {
+	AccountNumber               string
+	ResponseCode                string
+	Amount                      float64
+	SourceCustomerName          string
+	SourceCustomerAccountNumber string
+	PostedAt                    time.Time
+	SenderBank                  BankResponse
+	PaymentRef                  string
+	Requery                     *string
+	FTReference                 *string
+	SessionID                   string
+	Remark                      string
+}
+
+// ToInflow converts a PascalCase inflow notification into an Inflow,
+// resolving the sender bank against banks when it is non-nil.
+func (r InflowNotificationResult) ToInflow(banks ListOfBankResponse) (Inflow, error) {
+	return newInflow(r.AccountNumber, r.ResponseCode, r.Amount, r.SourceCustomerName,
+		r.SourceCustomerAccountNumber, r.Dateposted, r.SenderBank, r.PaymentRef,
+		nullableString(r.Requery), nullableString(r.FTReference), r.SessionID, r.Remark, banks)
+}
+
+// ToInflow converts a camelCase requery item into an Inflow, resolving the
+// sender bank against banks when it is non-nil.
+func (r InflowForAccountItem) ToInflow(banks ListOfBankResponse) (Inflow, error) {
+	return newInflow(r.AccountNumber, r.ResponseCode, r.Amount, r.SourceCustomerName,
+		r.SourceCustomerAccountNumber, r.Dateposted, r.SenderBank, r.PaymentRef,
+		nullableString(lo.FromPtr(r.Requery)), nullableString(lo.FromPtr(r.FtReference)), r.SessionID, r.Remark, banks)
+}
+
+// Inflows converts every record in the response into an Inflow.
+func (r *ListInflowResponse) Inflows(banks ListOfBankResponse) ([]Inflow, error) {
+	out := make([]Inflow, 0, len(r.Data))
+	for _, item := range r.Data {
+		inflow, err := item.ToInflow(banks)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, inflow)
+	}
+	return out, nil
+}
+
+// Inflows converts every record in the response into an Inflow.
+func (r *ListInflowForAccountResponse) Inflows(banks ListOfBankResponse) ([]Inflow, error) {
+	out := make([]Inflow, 0, len(r.Content))
+	for _, item := range r.Content {
+		inflow, err := item.ToInflow(banks)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, inflow)
+	}
+	return out, nil
+}
+
+func newInflow(
+	accountNumber,
+	responseCode,
+	amount,
+	sourceName,
+	sourceAccount,
+	datePosted,
+	senderBank,
+	paymentRef string,
+	requery,
+	ftReference *string,
+	sessionID,
+	remark string,
+	banks ListOfBankResponse,
+) (Inflow, error) {
+	parsedAmount, err := parseAmount(amount)
+	if err != nil {
+		return Inflow{}, fmt.Errorf("inflow %s amount: %w", sessionID, err)
+	}
+
+	postedAt, err := parseDatePosted(datePosted)
+	if err != nil {
+		return Inflow{}, fmt.Errorf("inflow %s date posted: %w", sessionID, err)
+	}
+
+	bank, ok := banks.Find(senderBank)
+	if !ok {
+		bank = BankResponse{BankName: senderBank}
+	}
+
+	return Inflow{
+		AccountNumber:               accountNumber,
+		ResponseCode:                responseCode,
+		Amount:                      parsedAmount,
+		SourceCustomerName:          sourceName,
+		SourceCustomerAccountNumber: sourceAccount,
+		PostedAt:                    postedAt,
+		SenderBank:                  bank,
+		PaymentRef:                  paymentRef,
+		Requery:                     requery,
+		FTReference:                 ftReference,
+		SessionID:                   sessionID,
+		Remark:                      remark,
+	}, nil
+}
+
+func parseAmount(val string) (float64, error) {
+	val = strings.ReplaceAll(strings.TrimSpace(val), ",", "")
+	if val == "" {
+		return 0, fmt.Errorf("%w: empty amount", ErrInvalidArgument)
+	}
+	return strconv.ParseFloat(val, 64)
+}
+
+func parseDatePosted(val string) (time.Time, error) {
+	val = strings.TrimSpace(val)
+	if t, err := time.Parse(time.RFC3339Nano, val); err == nil {
+		return t.In(Lagos), nil
+	}
+	for _, layout := range datePostedLayouts {
+		if t, err := time.ParseInLocation(layout, val, Lagos); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: unrecognised date %q", ErrInvalidArgument, val)
+}
+
+func nullableString(val string) *string {
+	val = strings.TrimSpace(val)
+	if val == "" || strings.EqualFold(val, "null") {
+		return nil
+	}
+	return &val
+}
+
+// InflowQuery describes a range of inflows to walk with ListInflows.
+// From and To are inclusive calendar days; To defaults to From when zero.
+// Account restricts results to a single credited account and SessionID
+// to a single NIP session. Banks, when set, is used to resolve sender banks.
+type InflowQuery struct {
+	Account   string
+	From      time.Time
+	To        time.Time
+	SessionID string
+	Banks     ListOfBankResponse
+}
+
+// InflowIterator walks every page of every day in an InflowQuery.
+// Call Next until it returns false, then check Err.
+type InflowIterator struct {
+	api   *Api
+	ctx   context.Context
+	query InflowQuery
+
+	day      time.Time
+	lastDay  time.Time
+	page     int
+	prevHead string
+
+	buf     []Inflow
+	current Inflow
+	done    bool
+	err     error
+}
+
+// ListInflows returns an iterator over all inflows matching query, fetching
+// pages of FetchPreviousTransactionsStatus lazily as the caller advances.
+func (a *Api) ListInflows(ctx context.Context, query InflowQuery) *InflowIterator {
+	it := &InflowIterator{api: a, ctx: ctx, query: query}
+	if query.From.IsZero() {
+		it.err = fmt.Errorf("list inflows: %w: from date is required", ErrInvalidArgument)
+		it.done = true
+		return it
+	}
+	if query.To.IsZero() {
+		query.To = query.From
+	}
+	it.day = truncateToDay(query.From.In(Lagos))
+	it.lastDay = truncateToDay(query.To.In(Lagos))
+	if it.lastDay.Before(it.day) {
+		it.err = fmt.Errorf("list inflows: %w: to date is before from date", ErrInvalidArgument)
+		it.done = true
+		return it
+	}
+	it.page = 1
+	return it
+}
+
+// Next advances the iterator, fetching the next page when the current one
+// is exhausted. It returns false when there are no more inflows, an error
+// occurred or the context was cancelled.
+func (it *InflowIterator) Next() bool {
+	for len(it.buf) == 0 {
+		if it.done {
+			return false
+		}
+		if err := it.ctx.Err(); err != nil {
+			it.err = err
+			it.done = true
+			return false
+		}
+		if err := it.fetch(); err != nil {
+			it.err = err
+			it.done = true
+			return false
+		}
+	}
+	it.current = it.buf[0]
+	it.buf = it.buf[1:]
+	return true
+}
+
+// Inflow returns the record the iterator is currently positioned on.
+func (it *InflowIterator) Inflow() Inflow {
+	return it.current
+}
+
+// Err returns the error that stopped iteration, if any.
+func (it *InflowIterator) Err() error {
+	return it.err
+}
+
+func (it *InflowIterator) fetch() (err error) {
+	ctx, span := it.api.startOperation(it.ctx, opListInflows, it.query.SessionID)
+	defer func() { endSpan(span, err) }()
+
+	result, err := it.api.fetchPreviousTransactionsPage(ctx, opListInflows, it.query.SessionID, it.day, it.page)
+	if err != nil {
+		return fmt.Errorf("list inflows for %s page %d: %w", it.day.Format(requeryDateLayout), it.page, err)
+	}
+
+	// an empty page ends the day; so does a page identical to the previous one,
+	// which is what the requery service returns when pageNumber is past the end
+	head := ""
+	if len(result.Content) > 0 {
+		head = result.Content[0].SessionID
+	}
+	if len(result.Content) == 0 || (it.page > 1 && head == it.prevHead) {
+		it.nextDay()
+		return nil
+	}
+	it.prevHead = head
+	it.page++
+
+	for _, item := range result.Content {
+		if it.query.Account != "" {
+			if item.AccountNumber != it.query.Account {
+				continue
+			}
+		} else if item.AccountNumber == it.api.OriginAccount(it.ctx) {
+			continue
+		}
+		if it.query.SessionID != "" && item.SessionID != it.query.SessionID {
+			continue
+		}
+		inflow, err := item.ToInflow(it.query.Banks)
+		if err != nil {
+			return err
+		}
+		it.buf = append(it.buf, inflow)
+	}
+	return nil
+}
+
+func (it *InflowIterator) nextDay() {
+	it.day = it.day.AddDate(0, 0, 1)
+	it.page = 1
+	it.prevHead = ""
+	if it.day.After(it.lastDay) {
+		it.done = true
+	}
+}
+
+func (a *Api) fetchPreviousTransactionsPage(ctx context.Context, op operation, sessionID string, date time.Time, page int) (*ListInflowForAccountResponse, error) {
+	reqData := map[string]any{
+		"SessionID":  sessionID,
+		"StartDate":  date.Format(requeryDateLayout),
+		"pageNumber": page,
+	}
+
+	var resultStruct ListInflowForAccountResponse
+	if err := a.requery(ctx, op, previousTransactionsUrl, http.MethodPost, reqData, &resultStruct); err != nil {
+		return nil, err
+	}
+	if message, failed := resultStruct.failure(); failed {
+		return nil, &OperationError{
+			Operation: op.name,
+			Method:    http.MethodPost,
+			Url:       previousTransactionsUrl,
+			Message:   message,
+			Err:       fmt.Errorf("requery service reported an error: %s", message),
+		}
+	}
+	return &resultStruct, nil
+}
+
+// failure reports a reply the requery service marked as an error, which
+// would otherwise read as an empty page. IsSuccess alone is not trusted,
+// since a reply without it decodes as false.
+func (r *ListInflowForAccountResponse) failure() (string, bool) {
+	if !r.HasError && r.ErrorMessage == "" && r.Error == nil {
+		return "", false
+	}
+	switch {
+	case r.ErrorMessage != "":
+		return r.ErrorMessage, true
+	case r.Error != nil:
+		return fmt.Sprint(r.Error), true
+	case r.Message != "":
+		return r.Message, true
+	}
+	return "no error message", true
+}
+
+func (a *Api) requery(ctx context.Context, op operation, url, method string, reqData any, out any) (err error) {
+	reqDataBytes, err := json.Marshal(reqData)
+	if err != nil {
+		return fmt.Errorf("json encoding: %w", err)
+	}
+
+	if a.dryRun {
+		return &DryRunError{Method: method, Url: url, Body: reqDataBytes}
+	}
+
+	if err := a.auditRequest(ctx, op, "", reqDataBytes); err != nil {
+		return err
+	}
+	var reply *Reply
+	auditStart := time.Now()
+	defer func() { a.auditResponse(ctx, op, "", reply, err, time.Since(auditStart)) }()
+
+	call := &Call{
+		Operation: op.name,
+		Method:    method,
+		Url:       url,
+		Header:    http.Header{"Content-Type": []string{"application/json"}},
+		Payload:   reqDataBytes,
+		Body:      reqDataBytes,
+		op:        op,
+	}
+	reply, err = a.handler(ctx, call)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(reply.Body, out); err != nil {
+		return newOperationError(call, reply, fmt.Errorf("could not unmarshal response to inflow result obj: %w", err))
+	}
+	return nil
+}
+
+func truncateToDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,168 @@
+package spay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// inflowPages answers FetchPreviousTransactionsStatus with the session IDs
+// pages[StartDate] holds for pageNumber, repeating the last page past the
+// end when repeat is set and returning an empty page otherwise. Every
+// request is appended to requests as "date/page".
+func inflowPages(pages map[string][][]string, repeat bool, requests *[]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			StartDate  string
+			PageNumber int `json:"pageNumber"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		*requests = append(*requests, fmt.Sprintf("%s/%d", req.StartDate, req.PageNumber))
+
+		var sessions []string
+		day := pages[req.StartDate]
+		switch {
+		case req.PageNumber <= len(day):
+			sessions = day[req.PageNumber-1]
+		case repeat && len(day) > 0:
+			sessions = day[len(day)-1]
+		}
+		var resp ListInflowForAccountResponse
+		for _, id := range sessions {
+			resp.Content = append(resp.Content, InflowForAccountItem{
+				AccountNumber: "0000000009",
+				Amount:        "1,000.00",
+				Dateposted:    req.StartDate + "T10:00:00",
+				SessionID:     id,
+			})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func TestListInflowsPaging(t *testing.T) {
+	pages := map[string][][]string{
+		"2024-03-04": {{"a1", "a2"}, {"a3"}},
+		"2024-03-06": {{"c1"}},
+	}
+	tests := []struct {
+		name         string
+		repeat       bool
+		to           time.Time
+		wantSessions []string
+		wantRequests []string
+	}{
+		{
+			name:         "empty page ends the day",
+			to:           time.Date(2024, 3, 6, 0, 0, 0, 0, Lagos),
+			wantSessions: []string{"a1", "a2", "a3", "c1"},
+			wantRequests: []string{"2024-03-04/1", "2024-03-04/2", "2024-03-04/3", "2024-03-05/1", "2024-03-06/1", "2024-03-06/2"},
+		},
+		{
+			name:         "repeated page ends the day",
+			repeat:       true,
+			to:           time.Date(2024, 3, 6, 0, 0, 0, 0, Lagos),
+			wantSessions: []string{"a1", "a2", "a3", "c1"},
+			wantRequests: []string{"2024-03-04/1", "2024-03-04/2", "2024-03-04/3", "2024-03-05/1", "2024-03-06/1", "2024-03-06/2"},
+		},
+		{
+			name:         "single day",
+			to:           time.Time{},
+			wantSessions: []string{"a1", "a2", "a3"},
+			wantRequests: []string{"2024-03-04/1", "2024-03-04/2", "2024-03-04/3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []string
+			api := newTestApi(t, inflowPages(pages, tt.repeat, &requests))
+			it := api.ListInflows(context.Background(), InflowQuery{From: time.Date(2024, 3, 4, 15, 0, 0, 0, Lagos), To: tt.to})
+			var sessions []string
+			for it.Next() {
+				sessions = append(sessions, it.Inflow().SessionID)
+			}
+			if err := it.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(sessions, tt.wantSessions) {
+				t.Errorf("sessions %v, want %v", sessions, tt.wantSessions)
+			}
+			if !reflect.DeepEqual(requests, tt.wantRequests) {
+				t.Errorf("requests %v, want %v", requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestListInflowsFilters(t *testing.T) {
+	var requests []string
+	api := newTestApi(t, inflowPages(map[string][][]string{"2024-03-04": {{"a1", "a2"}}}, false, &requests))
+	day := time.Date(2024, 3, 4, 0, 0, 0, 0, Lagos)
+
+	tests := []struct {
+		name  string
+		query InflowQuery
+		want  int
+	}{
+		{name: "all", query: InflowQuery{From: day}, want: 2},
+		{name: "session", query: InflowQuery{From: day, SessionID: "a2"}, want: 1},
+		{name: "other account", query: InflowQuery{From: day, Account: "0000000002"}, want: 0},
+	}
+	for _, tt := range tests {
+		it := api.ListInflows(context.Background(), tt.query)
+		n := 0
+		for it.Next() {
+			n++
+		}
+		if it.Err() != nil || n != tt.want {
+			t.Errorf("%s: %d inflows, %v; want %d", tt.name, n, it.Err(), tt.want)
+		}
+	}
+}
+
+func TestListInflowsInvalidRange(t *testing.T) {
+	api := newTestApi(t, reply(500, ""))
+	for _, q := range []InflowQuery{
+		{},
+		{From: time.Date(2024, 3, 4, 0, 0, 0, 0, Lagos), To: time.Date(2024, 3, 3, 0, 0, 0, 0, Lagos)},
+	} {
+		it := api.ListInflows(context.Background(), q)
+		if it.Next() || !errors.Is(it.Err(), ErrInvalidArgument) {
+			t.Errorf("ListInflows(%+v) error %v, want ErrInvalidArgument", q, it.Err())
+		}
+	}
+}
+
+func TestListInflowsPageError(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantMessage string
+	}{
+		{name: "has error", body: `{"content":[],"hasError":true,"isSuccess":false,"errorMessage":"Database timeout"}`, wantMessage: "Database timeout"},
+		{name: "error message only", body: `{"content":null,"errorMessage":"Invalid date"}`, wantMessage: "Invalid date"},
+		{name: "error object", body: `{"content":null,"hasError":true,"error":{"code":"E01"}}`, wantMessage: "map[code:E01]"},
+		{name: "has error with message", body: `{"hasError":true,"message":"Service unavailable"}`, wantMessage: "Service unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestApi(t, reply(200, tt.body))
+			it := api.ListInflows(context.Background(), InflowQuery{From: time.Date(2024, 3, 4, 0, 0, 0, 0, Lagos)})
+			if it.Next() {
+				t.Fatalf("got inflow %+v, want none", it.Inflow())
+			}
+			var opErr *OperationError
+			if !errors.As(it.Err(), &opErr) || opErr.Message != tt.wantMessage {
+				t.Fatalf("got %v, want an OperationError with message %q", it.Err(), tt.wantMessage)
+			}
+		})
+	}
+}
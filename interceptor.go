@@ -0,0 +1,272 @@
+package spay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Call is one HTTP exchange of a Spay or requery operation as interceptors
+// see it. Payload is the plaintext JSON request. Body is exactly what is
+// sent: the base64 ciphertext of Payload for Spay operations, or Payload
+// itself for requeries. Interceptors may add headers or replace Body, but a
+// changed Payload is not re-encrypted.
+type Call struct {
+	Operation   string
+	RequestType int
+	Reference   string
+	Method      string
+	Url         string
+	Header      http.Header
+	Payload     []byte
+	Body        []byte
+	Encrypted   bool
+
+	decrypt bool
+	op      operation
+}
+
+// Reply is the response to a Call. Raw is the body as received and Body is
+// the decrypted body, which equals Raw when responses are not encrypted.
+// Status is 0 when no response was received.
+type Reply struct {
+	Status int
+	Header http.Header
+	Raw    []byte
+	Body   []byte
+}
+
+// Handler performs a Call. It may return a Reply together with an error,
+// for instance for a Spay error response.
+type Handler func(ctx context.Context, call *Call) (*Reply, error)
+
+// Interceptor wraps a Handler, in the manner of an http.RoundTripper
+// middleware.
+type Interceptor func(next Handler) Handler
+
+// WithInterceptors adds interceptors around every request, the first given
+// outermost. They run outside the built-in logging and metrics
+// interceptors, so each attempt of a Retry is logged and measured.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(a *Api) {
+		a.interceptors = append(a.interceptors, interceptors...)
+	}
+}
+
+// buildHandler composes the interceptor chain once options are applied.
+func (a *Api) buildHandler() {
+	chain := append(append([]Interceptor{}, a.interceptors...), LoggingInterceptor(), MetricsInterceptor(a.metrics))
+	handler := Handler(a.roundTrip)
+	for i := len(chain) - 1; i >= 0; i-- {
+		handler = chain[i](handler)
+	}
+	a.handler = handler
+}
+
+// decryptError marks a response that arrived but could not be decrypted.
+type decryptError struct {
+	err error
+}
+
+func (e *decryptError) Error() string {
+	return fmt.Sprintf("decrypting response: %v", e.err)
+}
+
+func (e *decryptError) Unwrap() error {
+	return e.err
+}
+
+// roundTrip is the innermost Handler: it waits for the endpoint's rate
+// limit and breaker, sends the Call and decrypts the answer.
+func (a *Api) roundTrip(ctx context.Context, call *Call) (reply *Reply, err error) {
+	defer func() {
+		if err != nil {
+			err = newOperationError(call, reply, err)
+		}
+	}()
+
+	release, err := a.acquire(ctx, call.op)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	breakerName := BreakerSpay
+	if !call.Encrypted {
+		breakerName = BreakerRequery
+	}
+	done, err := a.allowRequest(ctx, breakerName)
+	if err != nil {
+		return nil, err
+	}
+	// no response or a 5xx counts against the breaker
+	failed := true
+	defer func() { done(failed) }()
+
+	ctx, span := a.tracer.Start(ctx, "request", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() { endSpan(span, err) }()
+
+	newReq, err := http.NewRequestWithContext(ctx, call.Method, call.Url, bytes.NewReader(call.Body))
+	if err != nil {
+		return nil, fmt.Errorf("spay request: %w", err)
+	}
+	for key, values := range call.Header {
+		for _, value := range values {
+			newReq.Header.Add(key, value)
+		}
+	}
+
+	result, err := a.httpClient.Do(newReq)
+	if err != nil {
+		return nil, fmt.Errorf("spay response: %w", err)
+	}
+	defer result.Body.Close()
+
+	reply = &Reply{Status: result.StatusCode, Header: result.Header}
+	reply.Raw, err = io.ReadAll(result.Body)
+	failed = err != nil || result.StatusCode >= 500
+	span.SetAttributes(attrHttpStatus.Int(result.StatusCode))
+	if err != nil {
+		return reply, fmt.Errorf("spay response reading: %w", err)
+	}
+
+	if result.StatusCode < 200 || result.StatusCode > 299 {
+		if len(reply.Raw) <= 0 {
+			return reply, fmt.Errorf("empty response received: %s", result.Status)
+		}
+
+		errBody := parseErrorBody(result.StatusCode, reply.Raw)
+		if apiErr, ok := errBody.(*ApiResponseErrorResult); ok {
+			span.SetAttributes(attrResponseCode.String(apiErr.Response))
+		}
+		return reply, errBody
+	}
+
+	reply.Body = reply.Raw
+	if call.decrypt {
+		decrypted, err := a.decrypt(ctx, string(reply.Raw))
+		if err != nil {
+			return reply, &decryptError{err: err}
+		}
+		reply.Body = []byte(decrypted)
+	}
+	return reply, nil
+}
+
+// LoggingInterceptor logs every exchange with logrus at info level, and
+// error responses at error level.
+func LoggingInterceptor() Interceptor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (*Reply, error) {
+			logrus.
+				WithField("operation", call.Operation).
+				WithField("url", call.Url).
+				WithField("method", call.Method).
+				WithField("body", string(call.Body)).
+				WithField("AppId", call.Header.Get("AppId")).
+				Info("sending request")
+
+			reply, err := next(ctx, call)
+			if reply == nil {
+				return reply, err
+			}
+
+			entry := logrus.
+				WithField("operation", call.Operation).
+				WithField("statusCode", reply.Status).
+				WithField("statusCodeText", http.StatusText(reply.Status)).
+				WithField("body", string(reply.Raw))
+			entry.Info("response result")
+			if reply.Status < 200 || reply.Status > 299 {
+				entry.Error("spay error response result")
+			}
+			return reply, err
+		}
+	}
+}
+
+// MetricsInterceptor reports request counts, latencies and decryption
+// failures to m.
+func MetricsInterceptor(m Metrics) Interceptor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (*Reply, error) {
+			start := time.Now()
+			reply, err := next(ctx, call)
+			// refused by a rate limit or breaker: nothing was sent
+			if errors.Is(err, ErrRateLimitWait) || errors.Is(err, ErrCircuitOpen) {
+				return reply, err
+			}
+			status := 0
+			if reply != nil {
+				status = reply.Status
+			}
+			m.ObserveRequest(call.Operation, status, time.Since(start))
+			var decryptErr *decryptError
+			if errors.As(err, &decryptErr) {
+				m.DecryptionFailed(call.Operation)
+			}
+			return reply, err
+		}
+	}
+}
+
+// RetryPolicy configures Retry. Attempts defaults to 3 and Backoff to
+// doubling from 200ms. Retryable defaults to DefaultRetryable.
+type RetryPolicy struct {
+	Attempts  int
+	Backoff   func(attempt int) time.Duration
+	Retryable func(call *Call, reply *Reply, err error) bool
+}
+
+// DefaultRetryable retries calls that got no response or a 5xx, except
+// transfers, whose outcome is unknown after such a failure.
+func DefaultRetryable(call *Call, reply *Reply, err error) bool {
+	if err == nil || call.op.endpoint() == EndpointTransfer {
+		return false
+	}
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrRateLimitWait) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return reply == nil || reply.Status >= 500
+}
+
+// Retry repeats calls policy deems retryable, waiting between attempts
+// unless ctx ends first.
+func Retry(policy RetryPolicy) Interceptor {
+	if policy.Attempts <= 0 {
+		policy.Attempts = 3
+	}
+	if policy.Backoff == nil {
+		policy.Backoff = func(attempt int) time.Duration {
+			return 200 * time.Millisecond << (attempt - 1)
+		}
+	}
+	if policy.Retryable == nil {
+		policy.Retryable = DefaultRetryable
+	}
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (*Reply, error) {
+			for attempt := 1; ; attempt++ {
+				reply, err := next(ctx, call)
+				if attempt >= policy.Attempts || !policy.Retryable(call, reply, err) {
+					return reply, err
+				}
+				timer := time.NewTimer(policy.Backoff(attempt))
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return reply, err
+				case <-timer.C:
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package spay
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const banksReply = `{"message":"ok","response":"00","data":{"status":"Successful","response":"[]"}}`
+
+// failing answers the first failures requests with status and later ones
+// with body, counting them all.
+func failing(failures int64, status int, body string, requests *atomic.Int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures {
+			w.WriteHeader(status)
+			w.Write([]byte(`{"message":"try again"}`))
+			return
+		}
+		w.Write([]byte(body))
+	}
+}
+
+func noBackoff(int) time.Duration { return 0 }
+
+func TestInterceptorOrder(t *testing.T) {
+	var order []string
+	var header string
+	named := func(name string) Interceptor {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, call *Call) (*Reply, error) {
+				order = append(order, name+" in")
+				call.Header.Set("X-Trace", call.Header.Get("X-Trace")+name)
+				reply, err := next(ctx, call)
+				order = append(order, name+" out")
+				return reply, err
+			}
+		}
+	}
+	api := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("X-Trace")
+		w.Write([]byte(banksReply))
+	}, WithInterceptors(named("a"), named("b")))
+
+	if _, err := api.ListBanks(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a in", "b in", "b out", "a out"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order %v, want %v", order, want)
+	}
+	if header != "ab" {
+		t.Errorf("header %q, want the one both interceptors built", header)
+	}
+}
+
+func TestInterceptorShortCircuit(t *testing.T) {
+	var requests atomic.Int64
+	fault := func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (*Reply, error) {
+			return &Reply{Status: 200, Body: []byte(banksReply)}, nil
+		}
+	}
+	api := newTestApi(t, failing(0, 0, banksReply, &requests), WithInterceptors(fault))
+	if _, err := api.ListBanks(); err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() != 0 {
+		t.Errorf("%d requests reached the server, want none", requests.Load())
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int64
+		status       int
+		transfer     bool
+		wantRequests int64
+		wantErr      bool
+	}{
+		{name: "recovers", failures: 2, status: 502, wantRequests: 3},
+		{name: "gives up", failures: 5, status: 503, wantRequests: 3, wantErr: true},
+		{name: "client error", failures: 1, status: 400, wantRequests: 1, wantErr: true},
+		{name: "transfer", failures: 1, status: 502, transfer: true, wantRequests: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int64
+			body := banksReply
+			if tt.transfer {
+				body = `{"response":"00","message":"ok"}`
+			}
+			api := newTestApi(t, failing(tt.failures, tt.status, body, &requests), WithInterceptors(Retry(RetryPolicy{Backoff: noBackoff})))
+
+			var err error
+			if tt.transfer {
+				_, err = api.SterlingTransfer(&SterlingToSterlingTransferRequest{ToAcct: "0000000002", Amt: 100})
+			} else {
+				_, err = api.ListBanks()
+			}
+			if (err != nil) != tt.wantErr || requests.Load() != tt.wantRequests {
+				t.Errorf("%d requests, error %v; want %d, error %v", requests.Load(), err, tt.wantRequests, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetryStopsWithContext(t *testing.T) {
+	var requests atomic.Int64
+	api := newTestApi(t, failing(5, 502, banksReply, &requests),
+		WithInterceptors(Retry(RetryPolicy{Attempts: 5, Backoff: func(int) time.Duration { return time.Hour }})))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := api.ListBanksContext(ctx)
+	var opErr *OperationError
+	if !errors.As(err, &opErr) || opErr.HttpStatus != 502 || requests.Load() != 1 {
+		t.Errorf("%d requests, error %v; want the first 502 and no retry", requests.Load(), err)
+	}
+}
+
+func TestDefaultRetryable(t *testing.T) {
+	banks := &Call{op: opListBanks}
+	tests := []struct {
+		name  string
+		call  *Call
+		reply *Reply
+		err   error
+		want  bool
+	}{
+		{name: "success", call: banks, reply: &Reply{Status: 200}},
+		{name: "no response", call: banks, err: errors.New("connection reset"), want: true},
+		{name: "server error", call: banks, reply: &Reply{Status: 500}, err: errors.New("unexpected error response"), want: true},
+		{name: "client error", call: banks, reply: &Reply{Status: 404}, err: errors.New("not found")},
+		{name: "transfer", call: &Call{op: opInterBankTransfer}, err: errors.New("connection reset")},
+		{name: "circuit open", call: banks, err: ErrCircuitOpen},
+		{name: "rate limited", call: banks, err: ErrRateLimitWait},
+		{name: "deadline", call: banks, err: context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		if got := DefaultRetryable(tt.call, tt.reply, tt.err); got != tt.want {
+			t.Errorf("%s: DefaultRetryable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
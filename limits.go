@@ -0,0 +1,233 @@
+package spay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Limit names carried by LimitError.
+const (
+	LimitSingleTransfer      = "single transfer"
+	LimitDailyTotal          = "daily total"
+	LimitDailyPerBeneficiary = "daily per beneficiary"
+	LimitHourlyCount         = "transfers per hour"
+)
+
+var (
+	// ErrLimitExceeded is wrapped by every LimitError.
+	ErrLimitExceeded = errors.New("transfer limit exceeded")
+	// ErrInvalidApproval is returned when an approval token is present but
+	// the policy rejects it, or the policy does not accept tokens at all.
+	ErrInvalidApproval = errors.New("invalid approval token")
+)
+
+// LimitError reports which limit a transfer would have breached.
+type LimitError struct {
+	Limit     string
+	Max       float64
+	Attempted float64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: %s limit is %.2f, transfer would reach %.2f", ErrLimitExceeded, e.Limit, e.Max, e.Attempted)
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// TransferIntent is what limit checks and approval verifiers see of a
+// transfer about to be sent.
+type TransferIntent struct {
+	Route       string
+	FromAccount string
+	ToAccount   string
+	BankCode    string
+	Amount      float64
+	Reference   string
+}
+
+// LimitPolicy caps outflows from the source account. Zero values disable a
+// limit. Days and hours are Africa/Lagos calendar windows.
+//
+// VerifyApproval, when set, validates tokens attached with WithApprovalToken;
+// a transfer carrying a valid token skips the limits but still counts
+// towards the totals.
+type LimitPolicy struct {
+	MaxSingleTransfer      float64
+	MaxDailyTotal          float64
+	MaxDailyPerBeneficiary float64
+	MaxTransfersPerHour    int
+	VerifyApproval         func(ctx context.Context, token string, intent TransferIntent) error
+}
+
+// LimitCounterStore keeps the running totals behind a LimitPolicy. Add must
+// be atomic: it increments the counter for key, which expires at expiry, and
+// returns the new totals. A negative amount and count undo an earlier Add.
+type LimitCounterStore interface {
+	Add(ctx context.Context, key string, expiry time.Time, amount float64, count int) (total float64, n int, err error)
+}
+
+// WithLimits enforces policy before every transfer is sent. A nil store
+// keeps counters in memory, which only limits a single process.
+func WithLimits(policy LimitPolicy, store LimitCounterStore) Option {
+	return func(a *Api) {
+		if store == nil {
+			store = NewMemoryLimitStore()
+		}
+		a.limits = &limiter{policy: policy, store: store}
+	}
+}
+
+type approvalKey struct{}
+
+// WithApprovalToken attaches a token that lets transfers made with ctx
+// exceed the configured limits, subject to LimitPolicy.VerifyApproval.
+func WithApprovalToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, approvalKey{}, token)
+}
+
+func approvalTokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(approvalKey{}).(string)
+	return token
+}
+
+type limiter struct {
+	policy LimitPolicy
+	store  LimitCounterStore
+}
+
+type limitCharge struct {
+	key    string
+	expiry time.Time
+	amount float64
+	count  int
+}
+
+// reserve counts intent against every window and returns a release func
+// that undoes the reservation. Callers release only when the transfer is
+// known not to have gone through; anything ambiguous stays counted.
+func (l *limiter) reserve(ctx context.Context, intent TransferIntent) (func(), error) {
+	bypass := false
+	if token := approvalTokenFromContext(ctx); token != "" {
+		if l.policy.VerifyApproval == nil {
+			return nil, ErrInvalidApproval
+		}
+		if err := l.policy.VerifyApproval(ctx, token, intent); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidApproval, err)
+		}
+		bypass = true
+	}
+
+	if !bypass && l.policy.MaxSingleTransfer > 0 && intent.Amount > l.policy.MaxSingleTransfer {
+		return nil, &LimitError{Limit: LimitSingleTransfer, Max: l.policy.MaxSingleTransfer, Attempted: intent.Amount}
+	}
+
+	now := time.Now().In(Lagos)
+	day := now.Format("2006-01-02")
+	dayEnd := truncateToDay(now).AddDate(0, 0, 1)
+	hourEnd := now.Truncate(time.Hour).Add(time.Hour)
+
+	checks := []struct {
+		charge limitCharge
+		limit  string
+		max    float64
+		byN    bool
+	}{
+		{limitCharge{"daily:" + intent.FromAccount + ":" + day, dayEnd, intent.Amount, 1}, LimitDailyTotal, l.policy.MaxDailyTotal, false},
+		{limitCharge{"beneficiary:" + intent.FromAccount + ":" + intent.BankCode + ":" + intent.ToAccount + ":" + day, dayEnd, intent.Amount, 1}, LimitDailyPerBeneficiary, l.policy.MaxDailyPerBeneficiary, false},
+		{limitCharge{"hourly:" + intent.FromAccount + ":" + now.Format("2006-01-02T15"), hourEnd, intent.Amount, 1}, LimitHourlyCount, float64(l.policy.MaxTransfersPerHour), true},
+	}
+
+	var charged []limitCharge
+	release := func() {
+		for _, c := range charged {
+			// best effort: a failed undo leaves the limit stricter, never looser
+			l.store.Add(context.Background(), c.key, c.expiry, -c.amount, -c.count)
+		}
+	}
+
+	for _, check := range checks {
+		if check.max <= 0 {
+			continue
+		}
+		total, n, err := l.store.Add(ctx, check.charge.key, check.charge.expiry, check.charge.amount, check.charge.count)
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("limit counter: %w", err)
+		}
+		charged = append(charged, check.charge)
+		if bypass {
+			continue
+		}
+		if check.byN && float64(n) > check.max {
+			release()
+			return nil, &LimitError{Limit: check.limit, Max: check.max, Attempted: float64(n)}
+		}
+		if !check.byN && total > check.max+0.005 {
+			release()
+			return nil, &LimitError{Limit: check.limit, Max: check.max, Attempted: total}
+		}
+	}
+
+	return release, nil
+}
+
+// checkLimits reserves intent against the configured limits, if any.
+func (a *Api) checkLimits(ctx context.Context, intent TransferIntent) (func(), error) {
+	if a.limits == nil || a.dryRun {
+		return func() {}, nil
+	}
+	return a.limits.reserve(ctx, intent)
+}
+
+// MemoryLimitStore is an in-process LimitCounterStore.
+type MemoryLimitStore struct {
+	mu       sync.Mutex
+	counters map[string]*memoryCounter
+}
+
+type memoryCounter struct {
+	total  float64
+	n      int
+	expiry time.Time
+}
+
+var _ LimitCounterStore = (*MemoryLimitStore)(nil)
+
+func NewMemoryLimitStore() *MemoryLimitStore {
+	return &MemoryLimitStore{counters: map[string]*memoryCounter{}}
+}
+
+func (m *MemoryLimitStore) Add(_ context.Context, key string, expiry time.Time, amount float64, count int) (float64, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for k, c := range m.counters {
+		if now.After(c.expiry) {
+			delete(m.counters, k)
+		}
+	}
+
+	c, ok := m.counters[key]
+	if !ok {
+		c = &memoryCounter{expiry: expiry}
+		m.counters[key] = c
+	}
+	c.total += amount
+	c.n += count
+	return c.total, c.n, nil
+}
+
+// releaseIfRejected gives back a limit reservation when the transfer
+// definitely did not go through. Network failures and undecodable responses
+// keep the reservation since the money may have moved.
+func releaseIfRejected(release func(), err error) {
+	if IsRejected(err) {
+		release()
+	}
+}
@@ -0,0 +1,140 @@
+package spay
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestLimiterReserve(t *testing.T) {
+	policy := LimitPolicy{
+		MaxSingleTransfer:      1000,
+		MaxDailyTotal:          2500,
+		MaxDailyPerBeneficiary: 1500,
+		MaxTransfersPerHour:    4,
+	}
+	intent := func(to string, amount float64) TransferIntent {
+		return TransferIntent{FromAccount: "0000000001", ToAccount: to, BankCode: "000014", Amount: amount}
+	}
+	tests := []struct {
+		name      string
+		before    []TransferIntent
+		intent    TransferIntent
+		wantLimit string
+	}{
+		{name: "within limits", intent: intent("a", 1000)},
+		{name: "single transfer", intent: intent("a", 1000.01), wantLimit: LimitSingleTransfer},
+		{name: "per beneficiary", before: []TransferIntent{intent("a", 1000)}, intent: intent("a", 600), wantLimit: LimitDailyPerBeneficiary},
+		{name: "other beneficiary", before: []TransferIntent{intent("a", 1000)}, intent: intent("b", 600)},
+		{name: "daily total", before: []TransferIntent{intent("a", 1000), intent("b", 1000)}, intent: intent("c", 600), wantLimit: LimitDailyTotal},
+		{name: "daily total reached exactly", before: []TransferIntent{intent("a", 1000), intent("b", 1000)}, intent: intent("c", 500)},
+		{name: "hourly count", before: []TransferIntent{intent("a", 1), intent("b", 1), intent("c", 1), intent("d", 1)}, intent: intent("e", 1), wantLimit: LimitHourlyCount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &limiter{policy: policy, store: NewMemoryLimitStore()}
+			for _, before := range tt.before {
+				if _, err := l.reserve(context.Background(), before); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err := l.reserve(context.Background(), tt.intent)
+			var limitErr *LimitError
+			switch {
+			case tt.wantLimit == "" && err != nil:
+				t.Fatalf("reserve: %v", err)
+			case tt.wantLimit != "" && (!errors.As(err, &limitErr) || limitErr.Limit != tt.wantLimit):
+				t.Fatalf("reserve: got %v, want the %s limit", err, tt.wantLimit)
+			case tt.wantLimit != "" && !errors.Is(err, ErrLimitExceeded):
+				t.Fatalf("reserve: %v does not wrap ErrLimitExceeded", err)
+			}
+		})
+	}
+}
+
+func TestLimiterRelease(t *testing.T) {
+	l := &limiter{policy: LimitPolicy{MaxDailyTotal: 1000, MaxTransfersPerHour: 1}, store: NewMemoryLimitStore()}
+	intent := TransferIntent{FromAccount: "0000000001", ToAccount: "a", Amount: 1000}
+
+	release, err := l.reserve(context.Background(), intent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.reserve(context.Background(), intent); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("second reserve: got %v, want ErrLimitExceeded", err)
+	}
+	release()
+	if _, err := l.reserve(context.Background(), intent); err != nil {
+		t.Fatalf("reserve after release: %v", err)
+	}
+}
+
+func TestLimiterApproval(t *testing.T) {
+	verify := func(ctx context.Context, token string, intent TransferIntent) error {
+		if token != "ok" {
+			return errors.New("unknown token")
+		}
+		return nil
+	}
+	tests := []struct {
+		name    string
+		verify  func(context.Context, string, TransferIntent) error
+		token   string
+		wantErr error
+	}{
+		{name: "no token", verify: verify, wantErr: ErrLimitExceeded},
+		{name: "valid token", verify: verify, token: "ok"},
+		{name: "invalid token", verify: verify, token: "bad", wantErr: ErrInvalidApproval},
+		{name: "no verifier", token: "ok", wantErr: ErrInvalidApproval},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryLimitStore()
+			l := &limiter{policy: LimitPolicy{MaxSingleTransfer: 10, MaxDailyTotal: 10, VerifyApproval: tt.verify}, store: store}
+			ctx := context.Background()
+			if tt.token != "" {
+				ctx = WithApprovalToken(ctx, tt.token)
+			}
+			intent := TransferIntent{FromAccount: "0000000001", ToAccount: "a", Amount: 100}
+			if _, err := l.reserve(ctx, intent); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("reserve: got %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			// an approved transfer still counts towards the totals
+			intent.Amount = 1
+			if _, err := l.reserve(context.Background(), intent); !errors.Is(err, ErrLimitExceeded) {
+				t.Fatalf("reserve after approved transfer: got %v, want ErrLimitExceeded", err)
+			}
+		})
+	}
+}
+
+func TestTransferReleasesLimitsWhenRejected(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		wantFreed bool
+	}{
+		{name: "rejected", status: 400, body: `{"response":"x51","data":{"ResponseText":"Insufficient Funds"}}`, wantFreed: true},
+		{name: "declined", status: 200, body: `{"response":"51","message":"no funds"}`, wantFreed: true},
+		{name: "bad gateway", status: 502, body: `{"message":"Bad gateway"}`},
+		{name: "pending", status: 200, body: `{"response":"09","message":"processing"}`},
+		{name: "sent", status: 200, body: `{"response":"00","message":"ok"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryLimitStore()
+			api := newTestApi(t, reply(tt.status, tt.body), WithLimits(LimitPolicy{MaxDailyTotal: 100}, store))
+			api.SterlingTransfer(&SterlingToSterlingTransferRequest{ToAcct: "0000000002", Amt: 100})
+
+			l := &limiter{policy: LimitPolicy{MaxDailyTotal: 100}, store: store}
+			_, err := l.reserve(context.Background(), TransferIntent{FromAccount: "0000000001", ToAccount: "0000000003", Amount: 1})
+			if freed := err == nil; freed != tt.wantFreed {
+				t.Errorf("limit freed %v, want %v (%v)", freed, tt.wantFreed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package spay
+
+import "time"
+
+// Operation names passed to Metrics, one per network method.
+const (
+	OpInterBankTransfer       = "InitiateInterBankTransfer"
+	OpListBanks               = "ListBanks"
+	OpGetStatement            = "GetStatement"
+	OpBalanceEnquiry          = "BalanceEnquiry"
+	OpSterlingTransfer        = "SterlingTransfer"
+	OpSterlingNameEnquiry     = "SterlingNameEnquiry"
+	OpOtherBanksNameEnquiry   = "OtherBanksNameEnquiry"
+	OpListInflowsForToday     = "ListInflowsForToday"
+	OpListInflowsForAccount   = "ListInflowsForTodayForAccountID"
+	OpQueryInflowsBySessionID = "QueryInflowsBySessionID"
+	OpListInflows             = "ListInflows"
+)
+
+// Transfer routes passed to Metrics.ObserveTransfer.
+const (
+	RouteIntrabank = "intrabank"
+	RouteInterbank = "interbank"
+)
+
+// Metrics receives instrumentation from every Api operation. Implementations
+// must be safe for concurrent use. The prommetrics package provides a
+// Prometheus implementation; the default records nothing.
+type Metrics interface {
+	// ObserveRequest is called once per HTTP exchange. status is 0 when no
+	// response was received.
+	ObserveRequest(operation string, status int, duration time.Duration)
+	// ObserveResponseCode records the Spay code from Response or Data.Status.
+	ObserveResponseCode(operation, code string)
+	// DecryptionFailed is called when a response could not be decrypted.
+	DecryptionFailed(operation string)
+	// ObserveTransfer records the amount of a successful transfer by route.
+	ObserveTransfer(route string, amount float64)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveRequest(string, int, time.Duration) {}
+func (noopMetrics) ObserveResponseCode(string, string)        {}
+func (noopMetrics) DecryptionFailed(string)                   {}
+func (noopMetrics) ObserveTransfer(string, float64)           {}
+
+// WithMetrics sends instrumentation to m instead of discarding it.
+func WithMetrics(m Metrics) Option {
+	return func(a *Api) {
+		if m != nil {
+			a.metrics = m
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package spay
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingMetrics struct {
+	mu        sync.Mutex
+	codes     []string
+	statuses  []int
+	transfers []float64
+}
+
+func (m *recordingMetrics) ObserveRequest(operation string, status int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.statuses = append(m.statuses, status)
+}
+
+func (m *recordingMetrics) ObserveResponseCode(operation, code string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.codes = append(m.codes, operation+"/"+code)
+}
+
+func (m *recordingMetrics) DecryptionFailed(operation string) {}
+
+func (m *recordingMetrics) ObserveTransfer(route string, amount float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.transfers = append(m.transfers, amount)
+}
+
+func TestMetricsResponseCodes(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		body          string
+		wantCodes     []string
+		wantTransfers []float64
+	}{
+		{name: "sent", status: 200, body: `{"response":"00","message":"ok"}`, wantCodes: []string{"SterlingTransfer/00"}, wantTransfers: []float64{100}},
+		{name: "declined", status: 200, body: `{"response":"51","message":"no funds"}`, wantCodes: []string{"SterlingTransfer/51"}},
+		{name: "rejected", status: 400, body: `{"response":"x51","data":{"ResponseText":"Insufficient Funds"}}`, wantCodes: []string{"SterlingTransfer/x51"}},
+		{name: "bad request without a code", status: 400, body: `{"message":"Bad request"}`},
+		{name: "bad gateway", status: 502, body: `{"response":"x51","message":"Bad gateway"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &recordingMetrics{}
+			api := newTestApi(t, reply(tt.status, tt.body), WithMetrics(m))
+			api.SterlingTransfer(&SterlingToSterlingTransferRequest{ToAcct: "0000000002", Amt: 100})
+			if !reflect.DeepEqual(m.codes, tt.wantCodes) {
+				t.Errorf("codes %v, want %v", m.codes, tt.wantCodes)
+			}
+			if !reflect.DeepEqual(m.statuses, []int{tt.status}) {
+				t.Errorf("statuses %v, want [%d]", m.statuses, tt.status)
+			}
+			if !reflect.DeepEqual(m.transfers, tt.wantTransfers) {
+				t.Errorf("transfers %v, want %v", m.transfers, tt.wantTransfers)
+			}
+		})
+	}
+}
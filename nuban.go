@@ -0,0 +1,50 @@
+package spay
+
+import (
+	"fmt"
+	"strings"
+)
+
+// nubanWeights are the CBN NUBAN check digit weights for the 3-digit bank
+// code followed by the 9-digit account serial.
+var nubanWeights = [12]int{3, 7, 3, 3, 7, 3, 3, 7, 3, 3, 7, 3}
+
+// ValidateNUBAN checks that accountNumber is a 10-digit NUBAN and that
+// bankCode is a 3-digit CBN code or a 6-digit NIP institution code. The
+// check digit can only be verified against a CBN code: NIP codes are not
+// derived from it, so for those only the format is checked.
+func ValidateNUBAN(accountNumber, bankCode string) error {
+	if len(accountNumber) != 10 || !isDigits(accountNumber) {
+		return fmt.Errorf("%w: account number %q is not 10 digits", ErrInvalidArgument, accountNumber)
+	}
+	if err := ValidateBankCode(bankCode); err != nil {
+		return err
+	}
+	if len(bankCode) != 3 {
+		return nil
+	}
+
+	digits := bankCode + accountNumber[:9]
+	sum := 0
+	for i, weight := range nubanWeights {
+		sum += int(digits[i]-'0') * weight
+	}
+	check := (10 - sum%10) % 10
+	if int(accountNumber[9]-'0') != check {
+		return fmt.Errorf("%w: account number %s fails the NUBAN check for bank %s", ErrInvalidArgument, accountNumber, bankCode)
+	}
+	return nil
+}
+
+// ValidateBankCode checks that bankCode is a 3-digit CBN code or a 6-digit
+// NIP institution code.
+func ValidateBankCode(bankCode string) error {
+	if (len(bankCode) != 3 && len(bankCode) != 6) || !isDigits(bankCode) {
+		return fmt.Errorf("%w: bank code %q is not 3 or 6 digits", ErrInvalidArgument, bankCode)
+	}
+	return nil
+}
+
+func isDigits(val string) bool {
+	return val != "" && strings.Trim(val, "0123456789") == ""
+}
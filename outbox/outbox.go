@@ -0,0 +1,506 @@
+// Package outbox submits transfers from a database table so that recording a
+// payout and sending it cannot drift apart. Applications insert instructions
+// with Enqueue inside their own transaction; Run or RunOnce later claims them,
+// sends them through spay.Api and records the outcome.
+//
+// The SQL targets PostgreSQL.
+//
+//	ob, err := outbox.New(db, api, outbox.Options{})
+//	err = ob.Migrate(ctx)
+//
+//	tx, _ := db.BeginTx(ctx, nil)
+//	// insert the application's payout row with tx, then
+//	err = ob.Enqueue(ctx, tx, outbox.Instruction{Reference: payoutID, Interbank: req})
+//	tx.Commit()
+//
+//	go ob.Run(ctx)
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/akacokafor/spay"
+	"github.com/segmentio/ksuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Instruction states. An instruction moves pending -> sending -> sent or
+// failed. Instructions Spay rejected go back to pending until MaxAttempts.
+// Ones whose outcome is unknown, including any answered with a response
+// code other than success, go to unknown unless Requery settles them, and
+// are never resent automatically.
+const (
+	StatusPending = "pending"
+	StatusSending = "sending"
+	StatusSent    = "sent"
+	StatusFailed  = "failed"
+	StatusUnknown = "unknown"
+)
+
+// Instruction is a transfer to send. Reference identifies it in the table
+// and becomes the request reference when the request has none. Exactly one
+// of Sterling and Interbank must be set.
+type Instruction struct {
+	Reference string
+	Sterling  *spay.SterlingToSterlingTransferRequest
+	Interbank *spay.InterBankTransferRequest
+}
+
+// payload is how an Instruction is stored. The name enquiry session id is
+// kept separately since the request type does not serialise it.
+type payload struct {
+	Sterling  *spay.SterlingToSterlingTransferRequest `json:"sterling,omitempty"`
+	Interbank *spay.InterBankTransferRequest          `json:"interbank,omitempty"`
+	SessionID string                                  `json:"sessionId,omitempty"`
+}
+
+// Record is a row of the outbox as the dispatcher last saw it.
+type Record struct {
+	ID          int64
+	Reference   string
+	Status      string
+	Attempts    int
+	Instruction Instruction
+	Result      json.RawMessage
+	LastError   string
+}
+
+// Execer is satisfied by *sql.DB, *sql.Tx and *sql.Conn.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+type Options struct {
+	// Table defaults to spay_outbox.
+	Table string
+	// BatchSize is how many instructions one RunOnce claims; default 10.
+	BatchSize int
+	// PollInterval is how long Run waits when nothing is due; default 5s.
+	PollInterval time.Duration
+	// Lease is how long a claimed instruction stays with one dispatcher
+	// before another may treat it as abandoned; default 2m.
+	Lease time.Duration
+	// MaxAttempts caps sends of an instruction Spay keeps rejecting;
+	// default 5.
+	MaxAttempts int
+	// Backoff returns the wait before attempt n+1; default doubles from 30s
+	// up to 30m.
+	Backoff func(attempts int) time.Duration
+	// Requery settles an instruction whose outcome is unknown, returning
+	// StatusSent, StatusFailed or "" when it still cannot tell. Spay has no
+	// status query for outbound transfers, so there is no default: without
+	// one, and for anything it cannot settle, instructions stay unknown
+	// for an operator to resolve. A Requery must only answer failed when it
+	// knows the transfer did not leave, since failed ones are sent again.
+	Requery func(ctx context.Context, record Record) (string, error)
+	// OnUpdate is told of each stored outcome inside a transaction that
+	// marks the outcome delivered, so an application can update its own
+	// rows atomically with that mark. The outcome itself is committed
+	// first: an error leaves it stored and undelivered, and OnUpdate is
+	// called again on the next RunOnce.
+	OnUpdate func(ctx context.Context, tx *sql.Tx, record Record) error
+}
+
+type Outbox struct {
+	db   *sql.DB
+	api  *spay.Api
+	opts Options
+}
+
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+func New(db *sql.DB, api *spay.Api, opts Options) (*Outbox, error) {
+	if opts.Table == "" {
+		opts.Table = "spay_outbox"
+	}
+	if !tableName.MatchString(opts.Table) {
+		return nil, fmt.Errorf("invalid outbox table name %q", opts.Table)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 10
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 5 * time.Second
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = 2 * time.Minute
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.Backoff == nil {
+		opts.Backoff = defaultBackoff
+	}
+	return &Outbox{db: db, api: api, opts: opts}, nil
+}
+
+func defaultBackoff(attempts int) time.Duration {
+	wait := 30 * time.Second
+	for i := 1; i < attempts && wait < 30*time.Minute; i++ {
+		wait *= 2
+	}
+	if wait > 30*time.Minute {
+		wait = 30 * time.Minute
+	}
+	return wait
+}
+
+// Schema returns the statements Migrate runs.
+func (o *Outbox) Schema() string {
+	return strings.ReplaceAll(strings.ReplaceAll(`CREATE TABLE IF NOT EXISTS {table} (
+	id BIGSERIAL PRIMARY KEY,
+	reference TEXT NOT NULL UNIQUE,
+	payload JSONB NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	claim TEXT,
+	locked_until TIMESTAMPTZ,
+	last_error TEXT,
+	result JSONB,
+	notified BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+ALTER TABLE {table} ADD COLUMN IF NOT EXISTS notified BOOLEAN NOT NULL DEFAULT TRUE;
+CREATE INDEX IF NOT EXISTS {index}_due ON {table} (status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS {index}_undelivered ON {table} (id) WHERE NOT notified;`,
+		"{table}", o.opts.Table), "{index}", strings.ReplaceAll(o.opts.Table, ".", "_"))
+}
+
+func (o *Outbox) Migrate(ctx context.Context) error {
+	for _, stmt := range strings.Split(o.Schema(), ";") {
+		if strings.TrimSpace(stmt) == "" {
+			continue
+		}
+		if _, err := o.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("outbox migrate: %w", err)
+		}
+	}
+	return nil
+}
+
+// Enqueue inserts ins with exec, normally the caller's transaction, so the
+// instruction exists exactly when the caller's own writes commit.
+// Enqueueing a reference twice fails on the unique constraint.
+func (o *Outbox) Enqueue(ctx context.Context, exec Execer, ins Instruction) error {
+	if ins.Reference == "" || (ins.Sterling == nil) == (ins.Interbank == nil) {
+		return fmt.Errorf("%w: an instruction needs a reference and exactly one request", spay.ErrInvalidArgument)
+	}
+	p := payload{Sterling: ins.Sterling, Interbank: ins.Interbank}
+	if ins.Interbank != nil {
+		p.SessionID = ins.Interbank.NameEnquirySessionID
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("outbox payload: %w", err)
+	}
+	_, err = exec.ExecContext(ctx,
+		fmt.Sprintf(`INSERT INTO %s (reference, payload) VALUES ($1, $2)`, o.opts.Table),
+		ins.Reference, string(data))
+	if err != nil {
+		return fmt.Errorf("outbox enqueue %s: %w", ins.Reference, err)
+	}
+	return nil
+}
+
+// Run dispatches due instructions until ctx is done.
+func (o *Outbox) Run(ctx context.Context) error {
+	for {
+		n, err := o.RunOnce(ctx)
+		if err != nil {
+			logrus.WithError(err).Error("outbox dispatch failed")
+		}
+		if n > 0 && err == nil {
+			continue
+		}
+		// jitter keeps several dispatchers from polling in lockstep
+		wait := o.opts.PollInterval + time.Duration(rand.Int63n(int64(o.opts.PollInterval)/4+1))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// claimed is a Record together with what the dispatcher needs to finish it.
+type claimed struct {
+	Record
+	claim     string
+	abandoned bool
+}
+
+// RunOnce delivers outcomes OnUpdate failed to take earlier, then claims up
+// to BatchSize due instructions, sends them and records the outcomes,
+// returning how many it claimed.
+func (o *Outbox) RunOnce(ctx context.Context) (int, error) {
+	if err := o.redeliver(ctx); err != nil {
+		return 0, err
+	}
+	batch, err := o.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, rec := range batch {
+		if ctx.Err() != nil {
+			// unsent claims are picked up again once their lease ends
+			return len(batch), ctx.Err()
+		}
+		if err := o.dispatch(ctx, rec); err != nil {
+			logrus.WithError(err).WithField("reference", rec.Reference).Error("outbox could not record outcome")
+		}
+	}
+	return len(batch), nil
+}
+
+// claim moves due instructions to sending under a fresh claim token.
+// Instructions still sending after their lease belonged to a dispatcher
+// that died mid-send and are claimed as abandoned.
+func (o *Outbox) claim(ctx context.Context) ([]*claimed, error) {
+	token := ksuid.New().String()
+	now := time.Now()
+	rows, err := o.db.QueryContext(ctx, fmt.Sprintf(`WITH due AS (
+	SELECT id, status FROM %[1]s
+	WHERE (status = 'pending' AND next_attempt_at <= $1 AND notified) OR (status = 'sending' AND locked_until < $1)
+	ORDER BY id LIMIT $2 FOR UPDATE SKIP LOCKED
+)
+UPDATE %[1]s t SET
+	status = 'sending', claim = $3, locked_until = $4, updated_at = $1,
+	attempts = CASE WHEN due.status = 'pending' THEN t.attempts + 1 ELSE t.attempts END
+FROM due WHERE t.id = due.id
+RETURNING t.id, t.reference, t.payload, t.attempts, due.status`, o.opts.Table),
+		now, o.opts.BatchSize, token, now.Add(o.opts.Lease))
+	if err != nil {
+		return nil, fmt.Errorf("outbox claim: %w", err)
+	}
+	defer rows.Close()
+
+	var batch []*claimed
+	for rows.Next() {
+		var rec claimed
+		var data []byte
+		var previous string
+		if err := rows.Scan(&rec.ID, &rec.Reference, &data, &rec.Attempts, &previous); err != nil {
+			return nil, fmt.Errorf("outbox claim: %w", err)
+		}
+		if rec.Instruction, err = decodePayload(rec.Reference, data); err != nil {
+			return nil, err
+		}
+		rec.Status = StatusSending
+		rec.claim = token
+		rec.abandoned = previous == StatusSending
+		batch = append(batch, &rec)
+	}
+	return batch, rows.Err()
+}
+
+func decodePayload(reference string, data []byte) (Instruction, error) {
+	var p payload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return Instruction{}, fmt.Errorf("outbox payload %s: %w", reference, err)
+	}
+	if p.Interbank != nil {
+		p.Interbank.NameEnquirySessionID = p.SessionID
+	}
+	return Instruction{Reference: reference, Sterling: p.Sterling, Interbank: p.Interbank}, nil
+}
+
+func (o *Outbox) dispatch(ctx context.Context, rec *claimed) error {
+	var status, reason string
+	var next time.Time
+	if rec.abandoned {
+		status, reason, next = o.settle(ctx, rec.Record, "abandoned while sending", time.Now())
+	} else {
+		result, err := o.send(ctx, rec.Instruction)
+		if err == nil {
+			rec.Result, _ = json.Marshal(result)
+		}
+		status, reason, next = o.outcome(ctx, rec.Record, err, time.Now())
+	}
+	return o.finish(ctx, rec, status, reason, next)
+}
+
+// outcome decides what to store for record after a send that returned err:
+// the status, the error to keep and, for a resend, when it is due.
+func (o *Outbox) outcome(ctx context.Context, record Record, err error, now time.Time) (string, string, time.Time) {
+	switch {
+	case err == nil:
+		return StatusSent, "", time.Time{}
+	case isPermanent(err):
+		return StatusFailed, err.Error(), time.Time{}
+	case spay.IsRejected(err) && !errors.Is(err, spay.ErrTransferNotCompleted):
+		// a response code other than success is left to settle below
+		status, next := o.retry(record.Attempts, now)
+		return status, err.Error(), next
+	default:
+		return o.settle(ctx, record, err.Error(), now)
+	}
+}
+
+// settle decides what happens to an instruction that may or may not have
+// been sent. Only a Requery answer of failed allows it to be sent again;
+// without a Requery it is left unknown.
+func (o *Outbox) settle(ctx context.Context, record Record, reason string, now time.Time) (string, string, time.Time) {
+	if o.opts.Requery == nil {
+		return StatusUnknown, reason, time.Time{}
+	}
+	status, err := o.opts.Requery(ctx, record)
+	if err != nil {
+		reason = fmt.Sprintf("%s; requery: %v", reason, err)
+	}
+	switch status {
+	case StatusSent:
+		return StatusSent, "", time.Time{}
+	case StatusFailed:
+		status, next := o.retry(record.Attempts, now)
+		return status, reason, next
+	default:
+		return StatusUnknown, reason, time.Time{}
+	}
+}
+
+// retry schedules another send, or gives up after MaxAttempts.
+func (o *Outbox) retry(attempts int, now time.Time) (string, time.Time) {
+	if attempts >= o.opts.MaxAttempts {
+		return StatusFailed, time.Time{}
+	}
+	return StatusPending, now.Add(o.opts.Backoff(attempts))
+}
+
+func (o *Outbox) send(ctx context.Context, ins Instruction) (any, error) {
+	if ins.Sterling != nil {
+		req := *ins.Sterling
+		if req.ReferenceId == "" {
+			req.ReferenceId = ins.Reference
+		}
+		return o.api.SterlingTransferContext(ctx, &req)
+	}
+	if ins.Interbank != nil {
+		req := *ins.Interbank
+		if req.Reference == "" {
+			req.Reference = ins.Reference
+		}
+		return o.api.InitiateInterBankTransferContext(ctx, &req)
+	}
+	return nil, spay.ErrInvalidArgument
+}
+
+// finish stores an outcome if rec is still held under its claim. OnUpdate
+// is then told in a transaction of its own, so an error there cannot lose
+// the outcome of a transfer that went out.
+func (o *Outbox) finish(ctx context.Context, rec *claimed, status, lastErr string, next time.Time) error {
+	// the dispatcher may be shutting down, but a send has to be recorded
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if next.IsZero() {
+		next = time.Now()
+	}
+	var result any
+	if len(rec.Result) > 0 {
+		result = string(rec.Result)
+	}
+	res, err := o.db.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET
+	status = $1, last_error = $2, result = COALESCE($3, result), next_attempt_at = $4,
+	claim = NULL, locked_until = NULL, notified = $7, updated_at = now()
+WHERE id = $5 AND claim = $6`, o.opts.Table),
+		status, lastErr, result, next, rec.ID, rec.claim, o.opts.OnUpdate == nil)
+	if err != nil {
+		return fmt.Errorf("outbox update %s: %w", rec.Reference, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("outbox update %s: claim lost to another dispatcher", rec.Reference)
+	}
+	rec.Status = status
+	rec.LastError = lastErr
+
+	if o.opts.OnUpdate == nil {
+		return nil
+	}
+	return o.deliver(ctx, rec.ID)
+}
+
+// deliver runs OnUpdate for the stored outcome of instruction id and marks
+// it delivered in the same transaction. An outcome another dispatcher is
+// delivering, or has delivered, is skipped.
+func (o *Outbox) deliver(ctx context.Context, id int64) error {
+	tx, err := o.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var rec Record
+	var data []byte
+	var result, lastErr sql.NullString
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT id, reference, payload, status, attempts, result, last_error
+FROM %s WHERE id = $1 AND NOT notified FOR UPDATE SKIP LOCKED`, o.opts.Table), id).
+		Scan(&rec.ID, &rec.Reference, &data, &rec.Status, &rec.Attempts, &result, &lastErr)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("outbox deliver %d: %w", id, err)
+	}
+	if rec.Instruction, err = decodePayload(rec.Reference, data); err != nil {
+		return err
+	}
+	if result.Valid {
+		rec.Result = json.RawMessage(result.String)
+	}
+	rec.LastError = lastErr.String
+
+	if err := o.opts.OnUpdate(ctx, tx, rec); err != nil {
+		return fmt.Errorf("outbox OnUpdate %s: %w", rec.Reference, err)
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET notified = TRUE WHERE id = $1`, o.opts.Table), id); err != nil {
+		return fmt.Errorf("outbox deliver %s: %w", rec.Reference, err)
+	}
+	return tx.Commit()
+}
+
+// redeliver retries OnUpdate for outcomes it failed to take.
+func (o *Outbox) redeliver(ctx context.Context) error {
+	if o.opts.OnUpdate == nil {
+		return nil
+	}
+	rows, err := o.db.QueryContext(ctx, fmt.Sprintf(`SELECT id FROM %s WHERE NOT notified AND status <> 'sending' ORDER BY id LIMIT $1`, o.opts.Table), o.opts.BatchSize)
+	if err != nil {
+		return fmt.Errorf("outbox redeliver: %w", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("outbox redeliver: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("outbox redeliver: %w", err)
+	}
+	for _, id := range ids {
+		if err := o.deliver(ctx, id); err != nil {
+			logrus.WithError(err).WithField("id", id).Error("outbox could not deliver outcome")
+		}
+	}
+	return nil
+}
+
+// isPermanent reports errors no retry can fix.
+func isPermanent(err error) bool {
+	return errors.Is(err, spay.ErrInvalidArgument) ||
+		errors.Is(err, spay.ErrLimitExceeded) ||
+		errors.Is(err, spay.ErrInvalidApproval)
+}
@@ -0,0 +1,131 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/akacokafor/spay"
+)
+
+func TestOutcome(t *testing.T) {
+	now := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+	opErr := func(status int, code string, cause error) error {
+		return &spay.OperationError{Operation: spay.OpInterBankTransfer, HttpStatus: status, Code: code, Err: cause}
+	}
+	rejected := opErr(400, "x51", &spay.ApiResponseErrorResult{Response: "x51"})
+	declined := opErr(200, "51", fmt.Errorf("%w: no funds", spay.ErrTransferNotCompleted))
+	gateway := opErr(502, "", errors.New("unexpected error response"))
+
+	tests := []struct {
+		name     string
+		err      error
+		attempts int
+		requery  string
+		noQuery  bool
+		queried  bool
+		want     string
+		wantNext time.Time
+	}{
+		{name: "sent", want: StatusSent},
+		{name: "invalid", err: fmt.Errorf("%w: amount", spay.ErrInvalidArgument), want: StatusFailed},
+		{name: "limit", err: &spay.LimitError{Limit: spay.LimitDailyTotal}, want: StatusFailed},
+		{name: "rejected is resent", err: rejected, attempts: 1, want: StatusPending, wantNext: now.Add(30 * time.Second)},
+		{name: "rejected backs off", err: rejected, attempts: 3, want: StatusPending, wantNext: now.Add(2 * time.Minute)},
+		{name: "rejected too often", err: rejected, attempts: 5, want: StatusFailed},
+		{name: "declined without requery", err: declined, noQuery: true, want: StatusUnknown},
+		{name: "gateway without requery", err: gateway, noQuery: true, want: StatusUnknown},
+		{name: "requery sent", queried: true, err: gateway, requery: StatusSent, want: StatusSent},
+		{name: "requery failed is resent", queried: true, err: gateway, attempts: 1, requery: StatusFailed, want: StatusPending, wantNext: now.Add(30 * time.Second)},
+		{name: "requery failed too often", queried: true, err: declined, attempts: 5, requery: StatusFailed, want: StatusFailed},
+		{name: "requery cannot tell", queried: true, err: declined, requery: "", want: StatusUnknown},
+		{name: "requery nonsense", queried: true, err: gateway, requery: "maybe", want: StatusUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queried := 0
+			opts := Options{}
+			if !tt.noQuery {
+				opts.Requery = func(ctx context.Context, record Record) (string, error) {
+					queried++
+					return tt.requery, nil
+				}
+			}
+			o, err := New(nil, nil, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			status, reason, next := o.outcome(context.Background(), Record{Reference: "ref", Attempts: tt.attempts}, tt.err, now)
+			if status != tt.want || !next.Equal(tt.wantNext) {
+				t.Errorf("outcome = %s at %s, want %s at %s", status, next, tt.want, tt.wantNext)
+			}
+			if (status == StatusSent) != (reason == "") {
+				t.Errorf("reason %q for %s", reason, status)
+			}
+			if (queried == 1) != tt.queried {
+				t.Errorf("Requery called %d times, want called %v", queried, tt.queried)
+			}
+		})
+	}
+}
+
+func TestSettleKeepsRequeryError(t *testing.T) {
+	o, err := New(nil, nil, Options{Requery: func(ctx context.Context, record Record) (string, error) {
+		return "", errors.New("requery down")
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, reason, _ := o.settle(context.Background(), Record{}, "abandoned while sending", time.Now())
+	if status != StatusUnknown || reason != "abandoned while sending; requery: requery down" {
+		t.Errorf("settle = %s, %q", status, reason)
+	}
+}
+
+func TestDecodePayload(t *testing.T) {
+	ins, err := decodePayload("ref", []byte(`{"interbank":{"Amount":"100","ToAccount":"0000000002"},"sessionId":"sess"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ins.Reference != "ref" || ins.Interbank == nil || ins.Interbank.NameEnquirySessionID != "sess" {
+		t.Errorf("decodePayload = %+v", ins)
+	}
+	if _, err := decodePayload("ref", []byte(`{`)); err == nil {
+		t.Error("decodePayload of a broken payload: want an error")
+	}
+}
+
+func TestNewValidatesTable(t *testing.T) {
+	for table, ok := range map[string]bool{
+		"":                 true,
+		"payouts_outbox":   true,
+		"billing.outbox":   true,
+		"outbox; DROP x":   false,
+		"a.b.c":            false,
+		"1outbox":          false,
+		`"quoted"`:         false,
+		"outbox_2024_q1":   true,
+		"billing.outbox_1": true,
+	} {
+		if _, err := New(nil, nil, Options{Table: table}); (err == nil) != ok {
+			t.Errorf("New with table %q: error %v, want ok %v", table, err, ok)
+		}
+	}
+}
+
+func TestDefaultBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{
+		0:  30 * time.Second,
+		1:  30 * time.Second,
+		2:  time.Minute,
+		6:  16 * time.Minute,
+		7:  30 * time.Minute,
+		50: 30 * time.Minute,
+	} {
+		if got := defaultBackoff(attempts); got != want {
+			t.Errorf("defaultBackoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
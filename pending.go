@@ -0,0 +1,460 @@
+package spay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+// Pending transfer statuses.
+const (
+	PendingStatusPending  = "pending"
+	PendingStatusRejected = "rejected"
+	PendingStatusExpired  = "expired"
+	// PendingStatusExecuting is held while the transfer is being sent. A
+	// transfer left in it by a crash stays there until Resolve closes it.
+	PendingStatusExecuting = "executing"
+	PendingStatusExecuted  = "executed"
+	// PendingStatusFailed means Spay refused the transfer or it was never
+	// sent; see IsRejected.
+	PendingStatusFailed = "failed"
+	// PendingStatusUnknown means the transfer may have gone through and
+	// has to be requeried before anyone submits it again.
+	PendingStatusUnknown = "unknown"
+)
+
+var (
+	ErrPendingTransferNotFound = errors.New("pending transfer not found")
+	// ErrPendingTransferClosed is returned when deciding on a transfer that
+	// is no longer pending, or resolving one that is already settled.
+	ErrPendingTransferClosed  = errors.New("pending transfer is no longer pending")
+	ErrPendingTransferExpired = errors.New("pending transfer has expired")
+	// ErrSelfApproval is returned when the maker tries to approve or reject
+	// their own transfer.
+	ErrSelfApproval    = errors.New("transfers cannot be decided by their maker")
+	ErrAlreadyApproved = errors.New("principal has already approved this transfer")
+	// ErrNoPrincipal is returned when ctx carries no principal; see
+	// WithPrincipal.
+	ErrNoPrincipal = errors.New("no principal in context")
+)
+
+// PendingTransfer is a transfer waiting for, or done with, maker-checker
+// approval. Exactly one of Sterling and Interbank is set. Reference is the
+// request reference it is sent with, assigned on submission, and SessionID
+// the name enquiry session ID of an interbank transfer, which its request
+// does not serialise.
+type PendingTransfer struct {
+	ID                string                             `json:"id"`
+	Route             string                             `json:"route"`
+	Amount            float64                            `json:"amount"`
+	Reference         string                             `json:"reference"`
+	SessionID         string                             `json:"sessionId,omitempty"`
+	Sterling          *SterlingToSterlingTransferRequest `json:"sterling,omitempty"`
+	Interbank         *InterBankTransferRequest          `json:"interbank,omitempty"`
+	Maker             string                             `json:"maker"`
+	RequiredApprovals int                                `json:"requiredApprovals"`
+	Approvals         []PendingDecision                  `json:"approvals,omitempty"`
+	Status            string                             `json:"status"`
+	CreatedAt         time.Time                          `json:"createdAt"`
+	ExpiresAt         time.Time                          `json:"expiresAt"`
+	History           []PendingStatusChange              `json:"history"`
+	Result            json.RawMessage                    `json:"result,omitempty"`
+	Error             string                             `json:"error,omitempty"`
+}
+
+type PendingDecision struct {
+	Principal string    `json:"principal"`
+	Time      time.Time `json:"time"`
+}
+
+// PendingStatusChange is one entry of a PendingTransfer's history.
+type PendingStatusChange struct {
+	Status    string    `json:"status"`
+	Principal string    `json:"principal,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+func (p *PendingTransfer) setStatus(status, principal, reason string) {
+	p.Status = status
+	p.History = append(p.History, PendingStatusChange{Status: status, Principal: principal, Reason: reason, Time: time.Now().UTC()})
+}
+
+// PendingTransferStore persists pending transfers. Update must apply fn to
+// the stored transfer and save the result atomically, so concurrent
+// approvals cannot both execute a transfer; an error from fn discards the
+// change.
+type PendingTransferStore interface {
+	Create(ctx context.Context, transfer *PendingTransfer) error
+	Get(ctx context.Context, id string) (*PendingTransfer, error)
+	Update(ctx context.Context, id string, fn func(*PendingTransfer) error) (*PendingTransfer, error)
+	List(ctx context.Context, status string) ([]*PendingTransfer, error)
+}
+
+// ApprovalPolicy decides which transfers need approval. Transfers of
+// Threshold or less are executed on submission; larger ones need
+// RequiredApprovals distinct checkers other than the maker within TTL.
+type ApprovalPolicy struct {
+	Threshold         float64
+	RequiredApprovals int
+	TTL               time.Duration
+}
+
+// Approvals runs the maker-checker workflow on top of an Api. The maker and
+// checkers are the principals set on ctx with WithPrincipal.
+type Approvals struct {
+	api    *Api
+	store  PendingTransferStore
+	policy ApprovalPolicy
+}
+
+// NewApprovals defaults RequiredApprovals to one and TTL to a day.
+func NewApprovals(api *Api, store PendingTransferStore, policy ApprovalPolicy) *Approvals {
+	if policy.RequiredApprovals < 1 {
+		policy.RequiredApprovals = 1
+	}
+	if policy.TTL <= 0 {
+		policy.TTL = 24 * time.Hour
+	}
+	return &Approvals{api: api, store: store, policy: policy}
+}
+
+func (m *Approvals) SubmitSterlingTransfer(ctx context.Context, req *SterlingToSterlingTransferRequest) (*PendingTransfer, error) {
+	if req == nil {
+		return nil, ErrInvalidArgument
+	}
+	transfer := *req
+	if transfer.ReferenceId == "" {
+		ref, err := m.api.NewReference()
+		if err != nil {
+			return nil, err
+		}
+		transfer.ReferenceId = ref
+	}
+	return m.submit(ctx, &PendingTransfer{Route: RouteIntrabank, Amount: req.Amt, Reference: transfer.ReferenceId, Sterling: &transfer})
+}
+
+func (m *Approvals) SubmitInterBankTransfer(ctx context.Context, req *InterBankTransferRequest) (*PendingTransfer, error) {
+	if req == nil {
+		return nil, ErrInvalidArgument
+	}
+	amount, err := parseAmount(req.Amount)
+	if err != nil {
+		return nil, fmt.Errorf("%w: amount %q", ErrInvalidArgument, req.Amount)
+	}
+	transfer := *req
+	if transfer.Reference == "" {
+		ref, err := m.api.NewReference()
+		if err != nil {
+			return nil, err
+		}
+		transfer.Reference = ref
+	}
+	return m.submit(ctx, &PendingTransfer{Route: RouteInterbank, Amount: amount, Reference: transfer.Reference, SessionID: req.NameEnquirySessionID, Interbank: &transfer})
+}
+
+func (m *Approvals) submit(ctx context.Context, transfer *PendingTransfer) (*PendingTransfer, error) {
+	maker := PrincipalFromContext(ctx)
+	if maker == "" {
+		return nil, ErrNoPrincipal
+	}
+	id, err := gonanoid.New(15)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate nano id reference: %w", err)
+	}
+
+	now := time.Now().UTC()
+	transfer.ID = id
+	transfer.Maker = maker
+	transfer.CreatedAt = now
+	transfer.ExpiresAt = now.Add(m.policy.TTL)
+	transfer.RequiredApprovals = m.policy.RequiredApprovals
+	if transfer.Amount <= m.policy.Threshold {
+		transfer.RequiredApprovals = 0
+	}
+	transfer.setStatus(PendingStatusPending, maker, "")
+
+	if err := m.store.Create(ctx, transfer); err != nil {
+		return nil, fmt.Errorf("store pending transfer: %w", err)
+	}
+	if transfer.RequiredApprovals == 0 {
+		return m.execute(ctx, transfer.ID, maker)
+	}
+	return transfer, nil
+}
+
+// Approve records the ctx principal's approval and executes the transfer
+// once it has enough of them.
+func (m *Approvals) Approve(ctx context.Context, id string) (*PendingTransfer, error) {
+	checker := PrincipalFromContext(ctx)
+	if checker == "" {
+		return nil, ErrNoPrincipal
+	}
+
+	transfer, err := m.store.Update(ctx, id, func(p *PendingTransfer) error {
+		if err := m.decidable(p, checker); err != nil {
+			return err
+		}
+		for _, approval := range p.Approvals {
+			if approval.Principal == checker {
+				return ErrAlreadyApproved
+			}
+		}
+		p.Approvals = append(p.Approvals, PendingDecision{Principal: checker, Time: time.Now().UTC()})
+		if len(p.Approvals) >= p.RequiredApprovals {
+			p.setStatus(PendingStatusExecuting, checker, "approved")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, m.expireOnError(ctx, id, err)
+	}
+	if transfer.Status != PendingStatusExecuting {
+		return transfer, nil
+	}
+	return m.run(ctx, transfer, checker)
+}
+
+// Reject closes the transfer without executing it.
+func (m *Approvals) Reject(ctx context.Context, id, reason string) (*PendingTransfer, error) {
+	checker := PrincipalFromContext(ctx)
+	if checker == "" {
+		return nil, ErrNoPrincipal
+	}
+	transfer, err := m.store.Update(ctx, id, func(p *PendingTransfer) error {
+		if err := m.decidable(p, checker); err != nil {
+			return err
+		}
+		p.setStatus(PendingStatusRejected, checker, reason)
+		return nil
+	})
+	if err != nil {
+		return nil, m.expireOnError(ctx, id, err)
+	}
+	return transfer, nil
+}
+
+// ExpireStale marks every pending transfer past its expiry as expired and
+// returns how many were.
+func (m *Approvals) ExpireStale(ctx context.Context) (int, error) {
+	pending, err := m.store.List(ctx, PendingStatusPending)
+	if err != nil {
+		return 0, err
+	}
+	expired := 0
+	for _, p := range pending {
+		if time.Now().Before(p.ExpiresAt) {
+			continue
+		}
+		if err := m.expire(ctx, p.ID); err == nil {
+			expired++
+		} else if !errors.Is(err, ErrPendingTransferClosed) {
+			return expired, err
+		}
+	}
+	return expired, nil
+}
+
+// Resolve records the outcome of a transfer left executing or unknown, as
+// found by requerying it or checking the statement, with status
+// PendingStatusExecuted or PendingStatusFailed. Nothing is sent: a failed
+// transfer stays closed and has to be submitted again. Only resolve an
+// executing transfer once the process sending it is known to have stopped,
+// or its own outcome will be recorded on top.
+func (m *Approvals) Resolve(ctx context.Context, id, status, reason string) (*PendingTransfer, error) {
+	principal := PrincipalFromContext(ctx)
+	if principal == "" {
+		return nil, ErrNoPrincipal
+	}
+	if status != PendingStatusExecuted && status != PendingStatusFailed {
+		return nil, fmt.Errorf("%w: cannot resolve a transfer as %q", ErrInvalidArgument, status)
+	}
+	return m.store.Update(ctx, id, func(p *PendingTransfer) error {
+		if p.Status != PendingStatusExecuting && p.Status != PendingStatusUnknown {
+			return fmt.Errorf("%w: %s", ErrPendingTransferClosed, p.Status)
+		}
+		p.setStatus(status, principal, reason)
+		return nil
+	})
+}
+
+func (m *Approvals) Get(ctx context.Context, id string) (*PendingTransfer, error) {
+	return m.store.Get(ctx, id)
+}
+
+func (m *Approvals) List(ctx context.Context, status string) ([]*PendingTransfer, error) {
+	return m.store.List(ctx, status)
+}
+
+func (m *Approvals) decidable(p *PendingTransfer, checker string) error {
+	if p.Status != PendingStatusPending {
+		return fmt.Errorf("%w: %s", ErrPendingTransferClosed, p.Status)
+	}
+	if !time.Now().Before(p.ExpiresAt) {
+		return ErrPendingTransferExpired
+	}
+	if p.Maker == checker {
+		return ErrSelfApproval
+	}
+	return nil
+}
+
+// expireOnError records the expiry a decision ran into, which decidable
+// cannot do itself since its error discards the update.
+func (m *Approvals) expireOnError(ctx context.Context, id string, err error) error {
+	if errors.Is(err, ErrPendingTransferExpired) {
+		m.expire(ctx, id)
+	}
+	return err
+}
+
+func (m *Approvals) expire(ctx context.Context, id string) error {
+	_, err := m.store.Update(ctx, id, func(p *PendingTransfer) error {
+		if p.Status != PendingStatusPending {
+			return ErrPendingTransferClosed
+		}
+		p.setStatus(PendingStatusExpired, "", "")
+		return nil
+	})
+	return err
+}
+
+func (m *Approvals) execute(ctx context.Context, id, principal string) (*PendingTransfer, error) {
+	transfer, err := m.store.Update(ctx, id, func(p *PendingTransfer) error {
+		if p.Status != PendingStatusPending {
+			return fmt.Errorf("%w: %s", ErrPendingTransferClosed, p.Status)
+		}
+		p.setStatus(PendingStatusExecuting, principal, "below approval threshold")
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.run(ctx, transfer, principal)
+}
+
+// run sends a transfer already moved to executing and records the outcome.
+// Only the caller that made that move gets here, so it is sent at most once.
+func (m *Approvals) run(ctx context.Context, transfer *PendingTransfer, principal string) (*PendingTransfer, error) {
+	var result any
+	var err error
+	switch {
+	case transfer.Sterling != nil:
+		result, err = m.api.SterlingTransferContext(ctx, transfer.Sterling)
+	case transfer.Interbank != nil:
+		req := *transfer.Interbank
+		req.NameEnquirySessionID = transfer.SessionID
+		result, err = m.api.InitiateInterBankTransferContext(ctx, &req)
+	default:
+		err = ErrInvalidArgument
+	}
+
+	updated, updateErr := m.store.Update(ctx, transfer.ID, func(p *PendingTransfer) error {
+		if err != nil {
+			p.Error = err.Error()
+			status := PendingStatusUnknown
+			if IsRejected(err) {
+				status = PendingStatusFailed
+			}
+			p.setStatus(status, principal, err.Error())
+			return nil
+		}
+		p.Result, _ = json.Marshal(result)
+		p.setStatus(PendingStatusExecuted, principal, "")
+		return nil
+	})
+	if updateErr != nil {
+		return nil, fmt.Errorf("transfer %s sent but its outcome could not be stored: %w", transfer.ID, updateErr)
+	}
+	return updated, err
+}
+
+// MemoryPendingTransferStore is an in-process PendingTransferStore.
+type MemoryPendingTransferStore struct {
+	mu        sync.Mutex
+	transfers map[string][]byte
+}
+
+var _ PendingTransferStore = (*MemoryPendingTransferStore)(nil)
+
+func NewMemoryPendingTransferStore() *MemoryPendingTransferStore {
+	return &MemoryPendingTransferStore{transfers: map[string][]byte{}}
+}
+
+// transfers are kept serialised so callers never share mutable state with
+// the store.
+
+func (s *MemoryPendingTransferStore) Create(_ context.Context, transfer *PendingTransfer) error {
+	data, err := json.Marshal(transfer)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.transfers[transfer.ID]; ok {
+		return fmt.Errorf("pending transfer %s already exists", transfer.ID)
+	}
+	s.transfers[transfer.ID] = data
+	return nil
+}
+
+func (s *MemoryPendingTransferStore) Get(_ context.Context, id string) (*PendingTransfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(id)
+}
+
+func (s *MemoryPendingTransferStore) Update(_ context.Context, id string, fn func(*PendingTransfer) error) (*PendingTransfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	transfer, err := s.load(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(transfer); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(transfer)
+	if err != nil {
+		return nil, err
+	}
+	s.transfers[id] = data
+	return transfer, nil
+}
+
+// List returns transfers with status, or all of them when status is empty,
+// oldest first.
+func (s *MemoryPendingTransferStore) List(_ context.Context, status string) ([]*PendingTransfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []*PendingTransfer
+	for id := range s.transfers {
+		transfer, err := s.load(id)
+		if err != nil {
+			return nil, err
+		}
+		if status == "" || transfer.Status == status {
+			out = append(out, transfer)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (s *MemoryPendingTransferStore) load(id string) (*PendingTransfer, error) {
+	data, ok := s.transfers[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrPendingTransferNotFound, id)
+	}
+	var transfer PendingTransfer
+	if err := json.Unmarshal(data, &transfer); err != nil {
+		return nil, err
+	}
+	return &transfer, nil
+}
@@ -0,0 +1,220 @@
+package spay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestApprovals returns Approvals over a test Api answering every
+// transfer with status and body, and the number of transfers sent.
+func newTestApprovals(t *testing.T, policy ApprovalPolicy, status int, body string) (*Approvals, *atomic.Int64) {
+	t.Helper()
+	var sent atomic.Int64
+	api := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		sent.Add(1)
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	})
+	return NewApprovals(api, NewMemoryPendingTransferStore(), policy), &sent
+}
+
+func as(principal string) context.Context {
+	return WithPrincipal(context.Background(), principal)
+}
+
+var largeTransfer = &SterlingToSterlingTransferRequest{ToAcct: "0000000002", Amt: 5000}
+
+func TestApprovalsBelowThreshold(t *testing.T) {
+	m, sent := newTestApprovals(t, ApprovalPolicy{Threshold: 1000}, 200, `{"response":"00","message":"ok"}`)
+	transfer, err := m.SubmitSterlingTransfer(as("maker"), &SterlingToSterlingTransferRequest{ToAcct: "0000000002", Amt: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transfer.Status != PendingStatusExecuted || transfer.Reference == "" || sent.Load() != 1 {
+		t.Errorf("status %s, reference %q, %d sent; want executed once with a reference", transfer.Status, transfer.Reference, sent.Load())
+	}
+}
+
+func TestApprovalsApprove(t *testing.T) {
+	m, sent := newTestApprovals(t, ApprovalPolicy{Threshold: 1000, RequiredApprovals: 2}, 200, `{"response":"00","message":"ok"}`)
+	if _, err := m.SubmitSterlingTransfer(context.Background(), largeTransfer); !errors.Is(err, ErrNoPrincipal) {
+		t.Fatalf("submit without a principal: got %v, want ErrNoPrincipal", err)
+	}
+	transfer, err := m.SubmitSterlingTransfer(as("maker"), largeTransfer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transfer.Status != PendingStatusPending {
+		t.Fatalf("status %s, want pending", transfer.Status)
+	}
+
+	steps := []struct {
+		principal  string
+		wantErr    error
+		wantStatus string
+		wantSent   int64
+	}{
+		{principal: "maker", wantErr: ErrSelfApproval, wantStatus: PendingStatusPending},
+		{principal: "checker1", wantStatus: PendingStatusPending},
+		{principal: "checker1", wantErr: ErrAlreadyApproved, wantStatus: PendingStatusPending},
+		{principal: "checker2", wantStatus: PendingStatusExecuted, wantSent: 1},
+		{principal: "checker3", wantErr: ErrPendingTransferClosed, wantStatus: PendingStatusExecuted, wantSent: 1},
+	}
+	for i, step := range steps {
+		_, err := m.Approve(as(step.principal), transfer.ID)
+		if !errors.Is(err, step.wantErr) {
+			t.Fatalf("step %d: %s approving: got %v, want %v", i, step.principal, err, step.wantErr)
+		}
+		stored, _ := m.Get(context.Background(), transfer.ID)
+		if stored.Status != step.wantStatus || sent.Load() != step.wantSent {
+			t.Fatalf("step %d: status %s with %d sent, want %s with %d", i, stored.Status, sent.Load(), step.wantStatus, step.wantSent)
+		}
+	}
+}
+
+func TestApprovalsReject(t *testing.T) {
+	m, sent := newTestApprovals(t, ApprovalPolicy{}, 200, `{"response":"00","message":"ok"}`)
+	transfer, err := m.SubmitSterlingTransfer(as("maker"), largeTransfer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Reject(as("maker"), transfer.ID, "changed my mind"); !errors.Is(err, ErrSelfApproval) {
+		t.Fatalf("maker rejecting: got %v, want ErrSelfApproval", err)
+	}
+	rejected, err := m.Reject(as("checker"), transfer.ID, "wrong beneficiary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := rejected.History[len(rejected.History)-1]
+	if rejected.Status != PendingStatusRejected || last.Principal != "checker" || last.Reason != "wrong beneficiary" {
+		t.Errorf("rejected transfer %+v", rejected)
+	}
+	if _, err := m.Approve(as("other"), transfer.ID); !errors.Is(err, ErrPendingTransferClosed) || sent.Load() != 0 {
+		t.Errorf("approving a rejected transfer: got %v with %d sent, want ErrPendingTransferClosed and none", err, sent.Load())
+	}
+}
+
+func TestApprovalsExpiry(t *testing.T) {
+	m, sent := newTestApprovals(t, ApprovalPolicy{TTL: time.Millisecond}, 200, `{"response":"00","message":"ok"}`)
+	first, err := m.SubmitSterlingTransfer(as("maker"), largeTransfer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := m.SubmitSterlingTransfer(as("maker"), largeTransfer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := m.Approve(as("checker"), first.ID); !errors.Is(err, ErrPendingTransferExpired) {
+		t.Fatalf("approving late: got %v, want ErrPendingTransferExpired", err)
+	}
+	if stored, _ := m.Get(context.Background(), first.ID); stored.Status != PendingStatusExpired {
+		t.Errorf("late approval left status %s, want expired", stored.Status)
+	}
+	if n, err := m.ExpireStale(context.Background()); n != 1 || err != nil {
+		t.Errorf("ExpireStale = %d, %v; want the second transfer expired", n, err)
+	}
+	if stored, _ := m.Get(context.Background(), second.ID); stored.Status != PendingStatusExpired || sent.Load() != 0 {
+		t.Errorf("status %s with %d sent, want expired and none", stored.Status, sent.Load())
+	}
+}
+
+func TestApprovalsExecuteOnce(t *testing.T) {
+	m, sent := newTestApprovals(t, ApprovalPolicy{}, 200, `{"response":"00","message":"ok"}`)
+	transfer, err := m.SubmitSterlingTransfer(as("maker"), largeTransfer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	var executed atomic.Int64
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := m.Approve(as(fmt.Sprintf("checker%d", i)), transfer.ID); err == nil {
+				executed.Add(1)
+			} else if !errors.Is(err, ErrPendingTransferClosed) {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if executed.Load() != 1 || sent.Load() != 1 {
+		t.Errorf("%d approvals executed, %d transfers sent; want one of each", executed.Load(), sent.Load())
+	}
+}
+
+func TestApprovalsOutcome(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{name: "executed", status: 200, body: `{"response":"00","message":"ok"}`, want: PendingStatusExecuted},
+		{name: "rejected", status: 400, body: `{"response":"x51","data":{"ResponseText":"Insufficient Funds"}}`, want: PendingStatusFailed},
+		{name: "declined", status: 200, body: `{"response":"51","message":"no funds"}`, want: PendingStatusFailed},
+		{name: "pending", status: 200, body: `{"response":"09","message":"processing"}`, want: PendingStatusUnknown},
+		{name: "bad gateway", status: 502, body: `{"message":"Bad gateway"}`, want: PendingStatusUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := newTestApprovals(t, ApprovalPolicy{Threshold: 10000}, tt.status, tt.body)
+			transfer, err := m.SubmitSterlingTransfer(as("maker"), largeTransfer)
+			if (err == nil) != (tt.want == PendingStatusExecuted) {
+				t.Errorf("submit error %v", err)
+			}
+			if transfer.Status != tt.want || (tt.want != PendingStatusExecuted && transfer.Error == "") {
+				t.Errorf("status %s, error %q; want %s", transfer.Status, transfer.Error, tt.want)
+			}
+		})
+	}
+}
+
+func TestApprovalsResolve(t *testing.T) {
+	m, sent := newTestApprovals(t, ApprovalPolicy{}, 200, `{"response":"00","message":"ok"}`)
+	ctx := context.Background()
+	transfer, err := m.SubmitSterlingTransfer(as("maker"), largeTransfer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Resolve(as("operator"), transfer.ID, PendingStatusExecuted, "statement"); !errors.Is(err, ErrPendingTransferClosed) {
+		t.Fatalf("resolving a pending transfer: got %v, want ErrPendingTransferClosed", err)
+	}
+
+	// a crash between the move to executing and the send leaves this behind
+	if _, err := m.store.Update(ctx, transfer.ID, func(p *PendingTransfer) error {
+		p.setStatus(PendingStatusExecuting, "checker", "approved")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Resolve(ctx, transfer.ID, PendingStatusFailed, ""); !errors.Is(err, ErrNoPrincipal) {
+		t.Errorf("resolving without a principal: got %v, want ErrNoPrincipal", err)
+	}
+	if _, err := m.Resolve(as("operator"), transfer.ID, PendingStatusPending, ""); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("resolving back to pending: got %v, want ErrInvalidArgument", err)
+	}
+	resolved, err := m.Resolve(as("operator"), transfer.ID, PendingStatusFailed, "not on the statement")
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := resolved.History[len(resolved.History)-1]
+	if resolved.Status != PendingStatusFailed || last.Principal != "operator" || last.Reason != "not on the statement" {
+		t.Errorf("resolved transfer %+v", resolved)
+	}
+	if _, err := m.Resolve(as("operator"), transfer.ID, PendingStatusExecuted, ""); !errors.Is(err, ErrPendingTransferClosed) {
+		t.Errorf("resolving twice: got %v, want ErrPendingTransferClosed", err)
+	}
+	if _, err := m.Approve(as("checker"), transfer.ID); !errors.Is(err, ErrPendingTransferClosed) || sent.Load() != 0 {
+		t.Errorf("approving a resolved transfer: got %v with %d sent, want ErrPendingTransferClosed and none", err, sent.Load())
+	}
+}
@@ -0,0 +1,139 @@
+package spay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// decryptPolicy says whether an operation's responses are decrypted.
+type decryptPolicy int
+
+const (
+	// decryptConfigured follows the shouldDecryptResponse given to NewApi.
+	decryptConfigured decryptPolicy = iota
+	decryptAlways
+	decryptNever
+)
+
+func (a *Api) shouldDecrypt(op operation) bool {
+	switch op.decrypt {
+	case decryptAlways:
+		return true
+	case decryptNever:
+		return false
+	default:
+		return a.shouldDecryptResponse
+	}
+}
+
+// spec describes how to read the response of a Spay operation: code and
+// message extract the response code and text, success decides whether the
+// operation went through (by default when code is "00"), and notCompleted,
+// when set, is the sentinel an unsuccessful response wraps.
+type spec[Resp any] struct {
+	op           operation
+	code         func(*Resp) string
+	message      func(*Resp) string
+	success      func(*Resp) bool
+	notCompleted error
+}
+
+// do runs one Spay operation under its own span: send req, decode the
+// response into Resp and check it against s. Every error is an
+// *OperationError.
+func do[Req, Resp any](ctx context.Context, a *Api, s spec[Resp], req Req) (_ *Resp, err error) {
+	var reference string
+	if r, ok := any(req).(interface{ reference() string }); ok {
+		reference = r.reference()
+	}
+	ctx, span := a.startOperation(ctx, s.op, reference)
+	defer func() { endSpan(span, err) }()
+
+	opErr := func(err error) *OperationError {
+		var existing *OperationError
+		if errors.As(err, &existing) {
+			return existing
+		}
+		return &OperationError{Operation: s.op.name, RequestType: s.op.requestType, Reference: reference, Err: err}
+	}
+
+	reply, err := a.send(ctx, s.op, req)
+	if err != nil {
+		e := opErr(err)
+		// a 4xx carrying a Spay code is a response like any other
+		if e.Response != nil {
+			a.observeResponse(span, s.op, e.Code)
+		}
+		return nil, e
+	}
+
+	var output Resp
+	if err := a.decode(ctx, reply.Body, &output); err != nil {
+		e := opErr(fmt.Errorf("decoding response: %w", err))
+		e.HttpStatus, e.Body = reply.Status, reply.Raw
+		return nil, e
+	}
+
+	code := s.code(&output)
+	a.observeResponse(span, s.op, code)
+
+	success := code == successfulStatusCode
+	if s.success != nil {
+		success = s.success(&output)
+	}
+	if !success {
+		logrus.WithField("operation", s.op.name).WithField("reference", reference).WithField("result", output).Error("operation completed without success")
+		message := s.message(&output)
+		cause := fmt.Errorf("could not complete request: %s", message)
+		if s.notCompleted != nil {
+			cause = fmt.Errorf("%w: %s", s.notCompleted, message)
+		}
+		e := opErr(cause)
+		e.HttpStatus, e.Body = reply.Status, reply.Raw
+		e.Code, e.Message = code, message
+		return nil, e
+	}
+	return &output, nil
+}
+
+var (
+	sterlingTransferSpec = spec[SterlingToSterlingTransferResult]{
+		op:           opSterlingTransfer,
+		code:         func(r *SterlingToSterlingTransferResult) string { return r.Response },
+		message:      func(r *SterlingToSterlingTransferResult) string { return r.Message },
+		notCompleted: ErrTransferNotCompleted,
+	}
+
+	interBankTransferSpec = spec[InterBankTransferResult]{
+		op:           opInterBankTransfer,
+		code:         func(r *InterBankTransferResult) string { return r.Response },
+		message:      func(r *InterBankTransferResult) string { return r.Message },
+		notCompleted: ErrTransferNotCompleted,
+	}
+
+	sterlingNameEnquirySpec = spec[ApiOperationResponse[SterlingNameEnquiryResponse]]{
+		op:      opSterlingNameEnquiry,
+		code:    func(r *ApiOperationResponse[SterlingNameEnquiryResponse]) string { return r.Data.Status },
+		message: func(r *ApiOperationResponse[SterlingNameEnquiryResponse]) string { return r.Response },
+	}
+
+	otherBanksNameEnquirySpec = spec[InterbankNameEnquiryResponse]{
+		op:      opOtherBanksNameEnquiry,
+		code:    func(r *InterbankNameEnquiryResponse) string { return r.Data.Status },
+		message: func(r *InterbankNameEnquiryResponse) string { return r.Response },
+	}
+)
+
+// listSpec is shared by the operations whose response wraps a JSON list in
+// Data.Response, reported successful by a Data.Status of "Successful".
+func listSpec(op operation) spec[ApiOperationResponse[ApiOperationResponseData]] {
+	return spec[ApiOperationResponse[ApiOperationResponseData]]{
+		op:      op,
+		code:    func(r *ApiOperationResponse[ApiOperationResponseData]) string { return r.Data.Status },
+		message: func(r *ApiOperationResponse[ApiOperationResponseData]) string { return r.Data.Response },
+		success: func(r *ApiOperationResponse[ApiOperationResponseData]) bool { return r.Data.Status == successfulStatus },
+	}
+}
@@ -0,0 +1,72 @@
+package spay
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestGetStatement(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []StatementLine
+		wantErr bool
+	}{
+		{
+			name: "lines",
+			body: `{"message":"ok","response":"00","data":{"status":"Successful","response":"[{\"TRA_DATE\":\"2024-03-04\",\"AMOUNT\":1500.5,\"REMARKS\":\"INV-1\",\"VALUE\":null,\"REVERSED\":false}]"}}`,
+			want: []StatementLine{{"TRA_DATE": "2024-03-04", "AMOUNT": "1500.5", "REMARKS": "INV-1", "REVERSED": "false"}},
+		},
+		{
+			name: "large amounts keep their digits",
+			body: `{"message":"ok","response":"00","data":{"status":"Successful","response":"[{\"AMOUNT\":12345678901.25}]"}}`,
+			want: []StatementLine{{"AMOUNT": "12345678901.25"}},
+		},
+		{
+			name: "empty",
+			body: `{"message":"ok","response":"00","data":{"status":"Successful","response":"[]"}}`,
+			want: []StatementLine{},
+		},
+		{
+			name:    "failed",
+			body:    `{"message":"ok","response":"00","data":{"status":"Failed","response":"No record"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "not a list",
+			body:    `{"message":"ok","response":"00","data":{"status":"Successful","response":"oops"}}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestApi(t, reply(200, tt.body))
+			got, err := api.GetStatement()
+			if tt.wantErr {
+				var opErr *OperationError
+				if !errors.As(err, &opErr) || opErr.Operation != OpGetStatement {
+					t.Fatalf("got %v, want a GetStatement OperationError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetStatement = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListBanks(t *testing.T) {
+	api := newTestApi(t, reply(200, `{"message":"ok","response":"00","data":{"status":"Successful","response":"[{\"BANKNAME\":\"Access Bank\",\"BANKCODE\":\"000014\"}]"}}`))
+	banks, err := api.ListBanks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bank, ok := banks.Find("access bank"); !ok || bank.BankCode != "000014" {
+		t.Errorf("ListBanks = %v", banks)
+	}
+}
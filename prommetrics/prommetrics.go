@@ -0,0 +1,124 @@
+// Package prommetrics implements spay.Metrics with Prometheus collectors.
+//
+//	m, err := prommetrics.New(prometheus.DefaultRegisterer, "myapp")
+//	api, err := spay.NewApi(..., spay.WithMetrics(m))
+//
+// With several clients in a spay.Registry, NewByClient adds a client label:
+//
+//	m, err := prommetrics.NewByClient(prometheus.DefaultRegisterer, "myapp")
+//	api, err := registry.Add("acme", spay.ClientConfig{..., Options: []spay.Option{spay.WithMetrics(m.For("acme"))}})
+package prommetrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/akacokafor/spay"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type Metrics struct {
+	requests        *prometheus.CounterVec
+	latency         prometheus.ObserverVec
+	responseCodes   *prometheus.CounterVec
+	decryptFailures *prometheus.CounterVec
+	transferAmounts prometheus.ObserverVec
+}
+
+// ClientMetrics labels every series with the client it belongs to.
+type ClientMetrics struct {
+	m *Metrics
+}
+
+var _ spay.Metrics = (*Metrics)(nil)
+
+// New creates the collectors under namespace and registers them with reg.
+func New(reg prometheus.Registerer, namespace string) (*Metrics, error) {
+	return newMetrics(reg, namespace)
+}
+
+// NewByClient is New with a client label on every series; see
+// ClientMetrics.For.
+func NewByClient(reg prometheus.Registerer, namespace string) (*ClientMetrics, error) {
+	m, err := newMetrics(reg, namespace, "client")
+	if err != nil {
+		return nil, err
+	}
+	return &ClientMetrics{m: m}, nil
+}
+
+// For returns the spay.Metrics of one client.
+func (c *ClientMetrics) For(client string) *Metrics {
+	labels := prometheus.Labels{"client": client}
+	return &Metrics{
+		requests:        c.m.requests.MustCurryWith(labels),
+		latency:         c.m.latency.MustCurryWith(labels),
+		responseCodes:   c.m.responseCodes.MustCurryWith(labels),
+		decryptFailures: c.m.decryptFailures.MustCurryWith(labels),
+		transferAmounts: c.m.transferAmounts.MustCurryWith(labels),
+	}
+}
+
+func newMetrics(reg prometheus.Registerer, namespace string, extra ...string) (*Metrics, error) {
+	labels := func(names ...string) []string {
+		return append(append([]string{}, extra...), names...)
+	}
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "spay",
+			Name:      "requests_total",
+			Help:      "HTTP requests sent to Spay by operation and HTTP status (0 when no response was received).",
+		}, labels("operation", "status")),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "spay",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of HTTP requests to Spay by operation.",
+			Buckets:   []float64{.1, .25, .5, 1, 2.5, 5, 10, 20, 30, 60},
+		}, labels("operation")),
+		responseCodes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "spay",
+			Name:      "responses_total",
+			Help:      "Decoded Spay responses by operation and response code.",
+		}, labels("operation", "code")),
+		decryptFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "spay",
+			Name:      "decryption_failures_total",
+			Help:      "Spay responses that could not be decrypted, by operation.",
+		}, labels("operation")),
+		transferAmounts: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "spay",
+			Name:      "transfer_amount_naira",
+			Help:      "Amounts of successful transfers in naira by route.",
+			Buckets:   []float64{1000, 5000, 10000, 50000, 100000, 500000, 1000000, 5000000},
+		}, labels("route")),
+	}
+
+	for _, c := range []prometheus.Collector{m.requests, m.latency, m.responseCodes, m.decryptFailures, m.transferAmounts} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *Metrics) ObserveRequest(operation string, status int, duration time.Duration) {
+	m.requests.WithLabelValues(operation, strconv.Itoa(status)).Inc()
+	m.latency.WithLabelValues(operation).Observe(duration.Seconds())
+}
+
+func (m *Metrics) ObserveResponseCode(operation, code string) {
+	m.responseCodes.WithLabelValues(operation, code).Inc()
+}
+
+func (m *Metrics) DecryptionFailed(operation string) {
+	m.decryptFailures.WithLabelValues(operation).Inc()
+}
+
+func (m *Metrics) ObserveTransfer(route string, amount float64) {
+	m.transferAmounts.WithLabelValues(route).Observe(amount)
+}
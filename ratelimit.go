@@ -0,0 +1,195 @@
+package spay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Endpoints that rate limits are configured for.
+const (
+	EndpointNameEnquiry = "name-enquiry"
+	EndpointTransfer    = "transfer"
+	EndpointBankList    = "bank-list"
+	EndpointAccount     = "account"
+	EndpointRequery     = "requery"
+)
+
+// ErrRateLimitWait is wrapped when ctx ends while a request is still waiting
+// for its rate limit or concurrency slot. Nothing was sent.
+var ErrRateLimitWait = errors.New("gave up waiting for rate limit")
+
+// EndpointLimit throttles one endpoint. Rate is requests per second with
+// bursts of up to Burst (at least one); MaxInFlight caps concurrent
+// requests. Zero values leave that side unlimited.
+type EndpointLimit struct {
+	Rate        float64
+	Burst       int
+	MaxInFlight int
+}
+
+// ThrottleStats is a snapshot of one endpoint's throttle.
+type ThrottleStats struct {
+	// Waiting is the number of requests queued for a token or a slot.
+	Waiting int
+	// InFlight is the number of requests holding a slot.
+	InFlight int
+}
+
+// WithRateLimits throttles requests per endpoint, keyed by the Endpoint
+// constants. Endpoints without an entry are not throttled.
+func WithRateLimits(limits map[string]EndpointLimit) Option {
+	return func(a *Api) {
+		a.throttles = map[string]*throttle{}
+		for endpoint, limit := range limits {
+			a.throttles[endpoint] = newThrottle(limit)
+		}
+	}
+}
+
+// ThrottleStats reports the queue depth and in-flight requests of endpoint.
+func (a *Api) ThrottleStats(endpoint string) ThrottleStats {
+	t, ok := a.throttles[endpoint]
+	if !ok {
+		return ThrottleStats{}
+	}
+	return ThrottleStats{Waiting: int(t.waiting.Load()), InFlight: int(t.inFlight.Load())}
+}
+
+func (o operation) endpoint() string {
+	switch o.name {
+	case OpSterlingNameEnquiry, OpOtherBanksNameEnquiry:
+		return EndpointNameEnquiry
+	case OpSterlingTransfer, OpInterBankTransfer:
+		return EndpointTransfer
+	case OpListBanks:
+		return EndpointBankList
+	case OpGetStatement, OpBalanceEnquiry:
+		return EndpointAccount
+	default:
+		return EndpointRequery
+	}
+}
+
+// acquire waits for op's endpoint to admit a request and returns the func
+// that gives its slot back.
+func (a *Api) acquire(ctx context.Context, op operation) (func(), error) {
+	endpoint := op.endpoint()
+	t, ok := a.throttles[endpoint]
+	if !ok {
+		return func() {}, nil
+	}
+	release, err := t.acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrRateLimitWait, endpoint, err)
+	}
+	return release, nil
+}
+
+type throttle struct {
+	bucket   *tokenBucket
+	slots    chan struct{}
+	waiting  atomic.Int64
+	inFlight atomic.Int64
+}
+
+func newThrottle(limit EndpointLimit) *throttle {
+	t := &throttle{}
+	if limit.Rate > 0 {
+		burst := limit.Burst
+		if burst < 1 {
+			burst = 1
+		}
+		t.bucket = &tokenBucket{rate: limit.Rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+	}
+	if limit.MaxInFlight > 0 {
+		t.slots = make(chan struct{}, limit.MaxInFlight)
+	}
+	return t
+}
+
+func (t *throttle) acquire(ctx context.Context) (func(), error) {
+	t.waiting.Add(1)
+	defer t.waiting.Add(-1)
+
+	if t.slots != nil {
+		select {
+		case t.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if t.bucket != nil {
+		if err := t.bucket.wait(ctx); err != nil {
+			if t.slots != nil {
+				<-t.slots
+			}
+			return nil, err
+		}
+	}
+
+	t.inFlight.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.inFlight.Add(-1)
+			if t.slots != nil {
+				<-t.slots
+			}
+		})
+	}, nil
+}
+
+// tokenBucket hands out tokens in arrival order: each caller takes one
+// immediately, possibly going into debt, and sleeps until the debt it
+// joined is repaid.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) wait(ctx context.Context) error {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	delay := time.Duration(0)
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		b.refund()
+		return context.DeadlineExceeded
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.refund()
+		return ctx.Err()
+	}
+}
+
+func (b *tokenBucket) refund() {
+	b.mu.Lock()
+	b.tokens++
+	b.mu.Unlock()
+}
@@ -0,0 +1,146 @@
+package spay
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOperationEndpoint(t *testing.T) {
+	for op, want := range map[operation]string{
+		opSterlingNameEnquiry:     EndpointNameEnquiry,
+		opOtherBanksNameEnquiry:   EndpointNameEnquiry,
+		opSterlingTransfer:        EndpointTransfer,
+		opInterBankTransfer:       EndpointTransfer,
+		opListBanks:               EndpointBankList,
+		opGetStatement:            EndpointAccount,
+		opBalanceEnquiry:          EndpointAccount,
+		opListInflowsForAccount:   EndpointRequery,
+		opQueryInflowsBySessionID: EndpointRequery,
+	} {
+		if got := op.endpoint(); got != want {
+			t.Errorf("%s endpoint = %s, want %s", op.name, got, want)
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	b := newThrottle(EndpointLimit{Rate: 50, Burst: 2}).bucket
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := b.wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+		t.Errorf("burst took %s, want no wait", elapsed)
+	}
+
+	// the third and fourth requests queue 20ms apart
+	for i := 0; i < 2; i++ {
+		if err := b.wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Errorf("four requests took %s, want about 40ms", elapsed)
+	}
+}
+
+func TestTokenBucketGivesUpEarly(t *testing.T) {
+	b := newThrottle(EndpointLimit{Rate: 1}).bucket
+	if err := b.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := b.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 25*time.Millisecond {
+		t.Errorf("gave up after %s, want straight away since the deadline cannot be met", elapsed)
+	}
+	// the refused request gave its token back rather than leave a debt
+	if b.tokens < -0.1 {
+		t.Errorf("tokens %v after the refund, want about 0", b.tokens)
+	}
+}
+
+func TestThrottleMaxInFlight(t *testing.T) {
+	th := newThrottle(EndpointLimit{MaxInFlight: 1})
+	release, err := th.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan func())
+	go func() {
+		next, err := th.acquire(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- next
+	}()
+	for th.waiting.Load() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if th.inFlight.Load() != 1 {
+		t.Errorf("%d in flight, want 1", th.inFlight.Load())
+	}
+
+	release()
+	release() // a second call must not free another slot
+	next := <-acquired
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := th.acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("acquire with the slot taken: got %v, want DeadlineExceeded", err)
+	}
+	next()
+	if th.inFlight.Load() != 0 || th.waiting.Load() != 0 {
+		t.Errorf("%d in flight and %d waiting after release, want none", th.inFlight.Load(), th.waiting.Load())
+	}
+}
+
+func TestRateLimitedTransfer(t *testing.T) {
+	var sent atomic.Int64
+	unblock := make(chan struct{})
+	api := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		sent.Add(1)
+		<-unblock
+		w.Write([]byte(`{"response":"00","message":"ok"}`))
+	}, WithRateLimits(map[string]EndpointLimit{EndpointTransfer: {MaxInFlight: 1}}))
+
+	done := make(chan error)
+	go func() {
+		_, err := api.SterlingTransfer(&SterlingToSterlingTransferRequest{ToAcct: "0000000002", Amt: 100})
+		done <- err
+	}()
+	for api.ThrottleStats(EndpointTransfer).InFlight != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := api.SterlingTransferContext(ctx, &SterlingToSterlingTransferRequest{ToAcct: "0000000002", Amt: 100})
+	if !errors.Is(err, ErrRateLimitWait) || !IsRejected(err) {
+		t.Errorf("got %v, want a rejected ErrRateLimitWait", err)
+	}
+	// other endpoints are not throttled
+	if stats := api.ThrottleStats(EndpointNameEnquiry); stats != (ThrottleStats{}) {
+		t.Errorf("name enquiry stats %+v, want none", stats)
+	}
+
+	close(unblock)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if sent.Load() != 1 {
+		t.Errorf("%d transfers sent, want only the first", sent.Load())
+	}
+}
@@ -0,0 +1,348 @@
+// Package reconcile matches the transactions a ledger expects against what
+// Sterling reports.
+//
+// Inflows convert with FromInflow. Statement lines, which carry outflows
+// too, convert with FromStatement; the statement format is not documented,
+// so the caller names the fields that hold each value.
+package reconcile
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akacokafor/spay"
+)
+
+type Direction int
+
+const (
+	Inflow Direction = iota
+	Outflow
+)
+
+func (d Direction) String() string {
+	if d == Outflow {
+		return "outflow"
+	}
+	return "inflow"
+}
+
+// Record is a single transaction on either side of a reconciliation. Expected
+// records come from the internal ledger; actual records are built from
+// inflows with FromInflow and statement lines with FromStatement.
+type Record struct {
+	Reference   string
+	PaymentRef  string
+	SessionID   string
+	FTReference string
+	Amount      float64
+	Date        time.Time
+	Direction   Direction
+}
+
+// MatchKey names the field a pair of records was matched on.
+type MatchKey string
+
+const (
+	MatchPaymentRef  MatchKey = "paymentRef"
+	MatchSessionID   MatchKey = "sessionID"
+	MatchFTReference MatchKey = "ftReference"
+	MatchAmountDate  MatchKey = "amountDate"
+)
+
+type Match struct {
+	Expected  Record
+	Actual    Record
+	MatchedOn MatchKey
+}
+
+type Result struct {
+	Matched          []Match
+	AmountMismatches []Match
+	Missing          []Record
+	Unexpected       []Record
+}
+
+// Options controls how loosely records are matched. AmountTolerance is an
+// absolute naira difference; DateTolerance bounds the amount/date fallback
+// used when no reference matches.
+type Options struct {
+	AmountTolerance float64
+	DateTolerance   time.Duration
+}
+
+var DefaultOptions = Options{
+	AmountTolerance: 0.005,
+	DateTolerance:   48 * time.Hour,
+}
+
+// FromInflow builds an actual record from an inflow returned by the client.
+func FromInflow(inflow spay.Inflow) Record {
+	var ftReference string
+	if inflow.FTReference != nil {
+		ftReference = *inflow.FTReference
+	}
+	return Record{
+		Reference:   inflow.SessionID,
+		PaymentRef:  inflow.PaymentRef,
+		SessionID:   inflow.SessionID,
+		FTReference: ftReference,
+		Amount:      inflow.Amount,
+		Date:        inflow.PostedAt,
+		Direction:   Inflow,
+	}
+}
+
+// FromInflows builds actual records from a slice of inflows.
+func FromInflows(inflows []spay.Inflow) []Record {
+	out := make([]Record, 0, len(inflows))
+	for _, inflow := range inflows {
+		out = append(out, FromInflow(inflow))
+	}
+	return out
+}
+
+// StatementFields names the statement line fields FromStatement reads.
+// Amount holds a signed amount, negative for money leaving the account;
+// statements that split amounts into columns set Debit and Credit instead.
+// Date is parsed with the first of DateLayouts that fits, in Lagos time
+// when the layout has no zone. Empty reference names are skipped.
+type StatementFields struct {
+	Amount      string
+	Debit       string
+	Credit      string
+	Date        string
+	DateLayouts []string
+	PaymentRef  string
+	SessionID   string
+	FTReference string
+}
+
+// FromStatement builds actual records from statement lines. A line whose
+// amount or date cannot be read is an error rather than a record that would
+// silently fail to match.
+func FromStatement(lines []spay.StatementLine, fields StatementFields) ([]Record, error) {
+	if fields.Amount == "" && fields.Debit == "" && fields.Credit == "" {
+		return nil, fmt.Errorf("%w: no amount field named", spay.ErrInvalidArgument)
+	}
+	if fields.Date == "" || len(fields.DateLayouts) == 0 {
+		return nil, fmt.Errorf("%w: no date field or layout named", spay.ErrInvalidArgument)
+	}
+	out := make([]Record, 0, len(lines))
+	for i, line := range lines {
+		amount, direction, err := statementAmount(line, fields)
+		if err != nil {
+			return nil, fmt.Errorf("statement line %d: %w", i, err)
+		}
+		date, err := statementDate(line[fields.Date], fields.DateLayouts)
+		if err != nil {
+			return nil, fmt.Errorf("statement line %d: %w", i, err)
+		}
+		rec := Record{
+			PaymentRef:  line[fields.PaymentRef],
+			SessionID:   line[fields.SessionID],
+			FTReference: line[fields.FTReference],
+			Amount:      amount,
+			Date:        date,
+			Direction:   direction,
+		}
+		for _, key := range []MatchKey{MatchSessionID, MatchFTReference, MatchPaymentRef} {
+			if rec.Reference = keyValue(rec, key); rec.Reference != "" {
+				break
+			}
+		}
+		out = append(out, rec)
+	}
+	return out, nil
+}
+
+func statementAmount(line spay.StatementLine, fields StatementFields) (float64, Direction, error) {
+	if fields.Amount != "" {
+		amount, err := parseAmount(line[fields.Amount])
+		if err != nil {
+			return 0, Inflow, fmt.Errorf("%s: %w", fields.Amount, err)
+		}
+		if amount < 0 {
+			return -amount, Outflow, nil
+		}
+		return amount, Inflow, nil
+	}
+	var debit, credit float64
+	var err error
+	if val := line[fields.Debit]; fields.Debit != "" && strings.TrimSpace(val) != "" {
+		if debit, err = parseAmount(val); err != nil {
+			return 0, Inflow, fmt.Errorf("%s: %w", fields.Debit, err)
+		}
+	}
+	if val := line[fields.Credit]; fields.Credit != "" && strings.TrimSpace(val) != "" {
+		if credit, err = parseAmount(val); err != nil {
+			return 0, Inflow, fmt.Errorf("%s: %w", fields.Credit, err)
+		}
+	}
+	switch {
+	case debit != 0 && credit != 0:
+		return 0, Inflow, fmt.Errorf("both debit %v and credit %v", debit, credit)
+	case debit != 0:
+		return math.Abs(debit), Outflow, nil
+	case credit != 0:
+		return math.Abs(credit), Inflow, nil
+	}
+	return 0, Inflow, fmt.Errorf("no debit or credit amount")
+}
+
+func parseAmount(val string) (float64, error) {
+	val = strings.ReplaceAll(strings.TrimSpace(val), ",", "")
+	if val == "" {
+		return 0, fmt.Errorf("no amount")
+	}
+	return strconv.ParseFloat(val, 64)
+}
+
+func statementDate(val string, layouts []string) (time.Time, error) {
+	val = strings.TrimSpace(val)
+	for _, layout := range layouts {
+		if date, err := time.ParseInLocation(layout, val, spay.Lagos); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("date %q matches none of %v", val, layouts)
+}
+
+// Reconcile pairs every expected record with at most one actual record.
+// References are tried first, in the order PaymentRef, SessionID,
+// FTReference; a reference match with a differing amount is reported as a
+// mismatch rather than a match. Records with no reference match fall back to
+// the closest actual record of the same direction and amount within
+// DateTolerance whose references do not contradict theirs.
+func Reconcile(expected, actual []Record, opts Options) Result {
+	var result Result
+	used := make([]bool, len(actual))
+
+	indexes := map[MatchKey]map[string][]int{
+		MatchPaymentRef:  {},
+		MatchSessionID:   {},
+		MatchFTReference: {},
+	}
+	for i, rec := range actual {
+		for key, index := range indexes {
+			if val := keyValue(rec, key); val != "" {
+				index[val] = append(index[val], i)
+			}
+		}
+	}
+
+	var unmatched []Record
+	for _, exp := range expected {
+		idx, key := findByReference(exp, actual, used, indexes)
+		if idx < 0 {
+			unmatched = append(unmatched, exp)
+			continue
+		}
+		used[idx] = true
+		match := Match{Expected: exp, Actual: actual[idx], MatchedOn: key}
+		if amountsEqual(exp.Amount, actual[idx].Amount, opts.AmountTolerance) {
+			result.Matched = append(result.Matched, match)
+		} else {
+			result.AmountMismatches = append(result.AmountMismatches, match)
+		}
+	}
+
+	for _, exp := range unmatched {
+		idx := findByAmountDate(exp, actual, used, opts)
+		if idx < 0 {
+			result.Missing = append(result.Missing, exp)
+			continue
+		}
+		used[idx] = true
+		result.Matched = append(result.Matched, Match{Expected: exp, Actual: actual[idx], MatchedOn: MatchAmountDate})
+	}
+
+	for i, rec := range actual {
+		if !used[i] {
+			result.Unexpected = append(result.Unexpected, rec)
+		}
+	}
+
+	return result
+}
+
+func findByReference(exp Record, actual []Record, used []bool, indexes map[MatchKey]map[string][]int) (int, MatchKey) {
+	for _, key := range []MatchKey{MatchPaymentRef, MatchSessionID, MatchFTReference} {
+		val := keyValue(exp, key)
+		if val == "" {
+			continue
+		}
+		for _, idx := range indexes[key][val] {
+			if !used[idx] && actual[idx].Direction == exp.Direction {
+				return idx, key
+			}
+		}
+	}
+	return -1, ""
+}
+
+func findByAmountDate(exp Record, actual []Record, used []bool, opts Options) int {
+	var candidates []int
+	for i, rec := range actual {
+		if used[i] || rec.Direction != exp.Direction {
+			continue
+		}
+		if !amountsEqual(exp.Amount, rec.Amount, opts.AmountTolerance) {
+			continue
+		}
+		if dateDistance(exp.Date, rec.Date) > opts.DateTolerance {
+			continue
+		}
+		if referencesConflict(exp, rec) {
+			continue
+		}
+		candidates = append(candidates, i)
+	}
+	if len(candidates) == 0 {
+		return -1
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return dateDistance(exp.Date, actual[candidates[i]].Date) < dateDistance(exp.Date, actual[candidates[j]].Date)
+	})
+	return candidates[0]
+}
+
+// referencesConflict reports two records that both carry a reference of
+// the same kind with different values, so are different transfers however
+// alike their amounts and dates.
+func referencesConflict(a, b Record) bool {
+	for _, key := range []MatchKey{MatchPaymentRef, MatchSessionID, MatchFTReference} {
+		if x, y := keyValue(a, key), keyValue(b, key); x != "" && y != "" && x != y {
+			return true
+		}
+	}
+	return false
+}
+
+func keyValue(rec Record, key MatchKey) string {
+	switch key {
+	case MatchPaymentRef:
+		return strings.TrimSpace(rec.PaymentRef)
+	case MatchSessionID:
+		return strings.TrimSpace(rec.SessionID)
+	case MatchFTReference:
+		return strings.TrimSpace(rec.FTReference)
+	}
+	return ""
+}
+
+func amountsEqual(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance
+}
+
+func dateDistance(a, b time.Time) time.Duration {
+	d := a.Sub(b)
+	if d < 0 {
+		return -d
+	}
+	return d
+}
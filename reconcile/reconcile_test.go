@@ -0,0 +1,181 @@
+package reconcile
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/akacokafor/spay"
+)
+
+var day = time.Date(2024, 3, 4, 10, 0, 0, 0, spay.Lagos)
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		name           string
+		expected       []Record
+		actual         []Record
+		wantMatched    []MatchKey
+		wantMismatches int
+		wantMissing    int
+		wantUnexpected int
+	}{
+		{
+			name:        "payment reference",
+			expected:    []Record{{PaymentRef: "INV-1", Amount: 100, Date: day}},
+			actual:      []Record{{PaymentRef: " INV-1 ", SessionID: "s1", Amount: 100, Date: day.Add(72 * time.Hour)}},
+			wantMatched: []MatchKey{MatchPaymentRef},
+		},
+		{
+			name:        "session before FT reference",
+			expected:    []Record{{SessionID: "s1", FTReference: "FT2", Amount: 100, Date: day}},
+			actual:      []Record{{FTReference: "FT2", Amount: 100, Date: day}, {SessionID: "s1", Amount: 100, Date: day}},
+			wantMatched: []MatchKey{MatchSessionID}, wantUnexpected: 1,
+		},
+		{
+			name:           "reference with another amount",
+			expected:       []Record{{SessionID: "s1", Amount: 100, Date: day}},
+			actual:         []Record{{SessionID: "s1", Amount: 90, Date: day}},
+			wantMismatches: 1,
+		},
+		{
+			name:        "amount within tolerance",
+			expected:    []Record{{SessionID: "s1", Amount: 100, Date: day}},
+			actual:      []Record{{SessionID: "s1", Amount: 100.004, Date: day}},
+			wantMatched: []MatchKey{MatchSessionID},
+		},
+		{
+			name:        "amount and date inside the window",
+			expected:    []Record{{PaymentRef: "INV-1", Amount: 100, Date: day}},
+			actual:      []Record{{SessionID: "s1", Amount: 100, Date: day.Add(47 * time.Hour)}},
+			wantMatched: []MatchKey{MatchAmountDate},
+		},
+		{
+			name:        "amount and date outside the window",
+			expected:    []Record{{Amount: 100, Date: day}},
+			actual:      []Record{{Amount: 100, Date: day.Add(-49 * time.Hour)}},
+			wantMissing: 1, wantUnexpected: 1,
+		},
+		{
+			name:        "amount and date in the other direction",
+			expected:    []Record{{Amount: 100, Date: day, Direction: Outflow}},
+			actual:      []Record{{Amount: 100, Date: day}},
+			wantMissing: 1, wantUnexpected: 1,
+		},
+		{
+			name:        "conflicting references never fall back",
+			expected:    []Record{{SessionID: "s1", Amount: 100, Date: day}},
+			actual:      []Record{{SessionID: "s2", Amount: 100, Date: day}},
+			wantMissing: 1, wantUnexpected: 1,
+		},
+		{
+			name:     "each actual record matches once",
+			expected: []Record{{SessionID: "s1", Amount: 100, Date: day}, {SessionID: "s1", Amount: 100, Date: day}},
+			actual:   []Record{{SessionID: "s1", Amount: 100, Date: day}},
+			// the second record falls back, finds nothing unused and is missing
+			wantMatched: []MatchKey{MatchSessionID}, wantMissing: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Reconcile(tt.expected, tt.actual, DefaultOptions)
+			var matched []MatchKey
+			for _, m := range result.Matched {
+				matched = append(matched, m.MatchedOn)
+			}
+			if !reflect.DeepEqual(matched, tt.wantMatched) {
+				t.Errorf("matched on %v, want %v", matched, tt.wantMatched)
+			}
+			if len(result.AmountMismatches) != tt.wantMismatches || len(result.Missing) != tt.wantMissing || len(result.Unexpected) != tt.wantUnexpected {
+				t.Errorf("%d mismatches, %d missing, %d unexpected; want %d, %d, %d",
+					len(result.AmountMismatches), len(result.Missing), len(result.Unexpected),
+					tt.wantMismatches, tt.wantMissing, tt.wantUnexpected)
+			}
+		})
+	}
+}
+
+func TestReconcileClosestDate(t *testing.T) {
+	result := Reconcile(
+		[]Record{{Amount: 100, Date: day}},
+		[]Record{{SessionID: "far", Amount: 100, Date: day.Add(40 * time.Hour)}, {SessionID: "near", Amount: 100, Date: day.Add(-time.Hour)}},
+		DefaultOptions,
+	)
+	if len(result.Matched) != 1 || result.Matched[0].Actual.SessionID != "near" {
+		t.Errorf("matched %+v, want the nearer record", result.Matched)
+	}
+}
+
+func TestFromStatement(t *testing.T) {
+	layouts := []string{"02-Jan-2006", "2006-01-02T15:04:05"}
+	signed := StatementFields{Amount: "AMOUNT", Date: "TRADATE", DateLayouts: layouts, SessionID: "SESSIONID", FTReference: "FTREF"}
+	columns := StatementFields{Debit: "DEBIT", Credit: "CREDIT", Date: "TRADATE", DateLayouts: layouts, PaymentRef: "NARRATION"}
+
+	tests := []struct {
+		name    string
+		fields  StatementFields
+		line    spay.StatementLine
+		want    Record
+		wantErr bool
+	}{
+		{
+			name:   "signed outflow",
+			fields: signed,
+			line:   spay.StatementLine{"AMOUNT": "-1,500.00", "TRADATE": "04-Mar-2024", "SESSIONID": "s1", "FTREF": "FT1"},
+			want:   Record{Reference: "s1", SessionID: "s1", FTReference: "FT1", Amount: 1500, Date: time.Date(2024, 3, 4, 0, 0, 0, 0, spay.Lagos), Direction: Outflow},
+		},
+		{
+			name:   "signed inflow",
+			fields: signed,
+			line:   spay.StatementLine{"AMOUNT": "250", "TRADATE": "2024-03-04T10:00:00", "FTREF": "FT2"},
+			want:   Record{Reference: "FT2", FTReference: "FT2", Amount: 250, Date: day},
+		},
+		{
+			name:   "debit column",
+			fields: columns,
+			line:   spay.StatementLine{"DEBIT": "100.50", "CREDIT": "", "TRADATE": "04-Mar-2024", "NARRATION": "INV-1"},
+			want:   Record{Reference: "INV-1", PaymentRef: "INV-1", Amount: 100.5, Date: time.Date(2024, 3, 4, 0, 0, 0, 0, spay.Lagos), Direction: Outflow},
+		},
+		{
+			name:   "credit column",
+			fields: columns,
+			line:   spay.StatementLine{"DEBIT": "0", "CREDIT": "75", "TRADATE": "04-Mar-2024"},
+			want:   Record{Amount: 75, Date: time.Date(2024, 3, 4, 0, 0, 0, 0, spay.Lagos)},
+		},
+		{name: "no amount", fields: signed, line: spay.StatementLine{"TRADATE": "04-Mar-2024"}, wantErr: true},
+		{name: "bad amount", fields: signed, line: spay.StatementLine{"AMOUNT": "N100", "TRADATE": "04-Mar-2024"}, wantErr: true},
+		{name: "debit and credit", fields: columns, line: spay.StatementLine{"DEBIT": "1", "CREDIT": "1", "TRADATE": "04-Mar-2024"}, wantErr: true},
+		{name: "neither debit nor credit", fields: columns, line: spay.StatementLine{"TRADATE": "04-Mar-2024"}, wantErr: true},
+		{name: "bad date", fields: signed, line: spay.StatementLine{"AMOUNT": "1", "TRADATE": "4/3/2024"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := FromStatement([]spay.StatementLine{tt.line}, tt.fields)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", records)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 1 || !reflect.DeepEqual(records[0], tt.want) {
+				t.Errorf("got %+v, want %+v", records, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromStatementNeedsFields(t *testing.T) {
+	for _, fields := range []StatementFields{
+		{Date: "TRADATE", DateLayouts: []string{time.DateOnly}},
+		{Amount: "AMOUNT", DateLayouts: []string{time.DateOnly}},
+		{Amount: "AMOUNT", Date: "TRADATE"},
+	} {
+		if _, err := FromStatement(nil, fields); !errors.Is(err, spay.ErrInvalidArgument) {
+			t.Errorf("FromStatement(%+v): got %v, want ErrInvalidArgument", fields, err)
+		}
+	}
+}
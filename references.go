@@ -0,0 +1,177 @@
+package spay
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+const referenceAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// ReferenceGenerator issues request references. Implementations must be
+// safe for concurrent use and never issue the same reference twice.
+type ReferenceGenerator interface {
+	NewReference() (string, error)
+}
+
+// ReferenceFormat is what a request reference must look like before it is
+// sent. A zero MaxLength or nil Pattern skips that check. Sterling does not
+// document a limit, so the Api checks nothing until WithReferenceFormat
+// sets one.
+type ReferenceFormat struct {
+	MaxLength int
+	Pattern   *regexp.Regexp
+}
+
+// SafeReferenceFormat allows up to 30 letters, digits, dashes and
+// underscores, which covers nano IDs and ksuids but not UUIDs.
+func SafeReferenceFormat() ReferenceFormat {
+	return ReferenceFormat{MaxLength: 30, Pattern: regexp.MustCompile(`^[A-Za-z0-9_-]+$`)}
+}
+
+// Validate checks ref against the format. Errors wrap ErrInvalidArgument.
+func (f ReferenceFormat) Validate(ref string) error {
+	if ref == "" {
+		return fmt.Errorf("%w: empty reference", ErrInvalidArgument)
+	}
+	if f.MaxLength > 0 && len(ref) > f.MaxLength {
+		return fmt.Errorf("%w: reference %q is longer than %d characters", ErrInvalidArgument, ref, f.MaxLength)
+	}
+	if f.Pattern != nil && !f.Pattern.MatchString(ref) {
+		return fmt.Errorf("%w: reference %q does not match %s", ErrInvalidArgument, ref, f.Pattern)
+	}
+	return nil
+}
+
+// WithReferenceGenerator replaces the generator for references the Api
+// fills in itself: transfers without one, name enquiries and list
+// operations.
+func WithReferenceGenerator(gen ReferenceGenerator) Option {
+	return func(a *Api) {
+		if gen != nil {
+			a.references = gen
+		}
+	}
+}
+
+// WithReferenceFormat sets the checks every request reference must pass.
+func WithReferenceFormat(format ReferenceFormat) Option {
+	return func(a *Api) {
+		a.referenceFormat = format
+	}
+}
+
+// NewReference issues a reference from the Api's generator.
+func (a *Api) NewReference() (string, error) {
+	ref, err := a.references.NewReference()
+	if err != nil {
+		return "", fmt.Errorf("generating reference: %w", err)
+	}
+	return ref, nil
+}
+
+// RandomReferenceGenerator issues Prefix followed by random letters and
+// digits, Length characters in all (15 when zero). At 15 characters a
+// collision is as likely as guessing 89 random bits.
+type RandomReferenceGenerator struct {
+	Prefix string
+	Length int
+}
+
+func (g RandomReferenceGenerator) NewReference() (string, error) {
+	n, err := referenceBody(g.Prefix, g.Length, 15)
+	if err != nil {
+		return "", err
+	}
+	body, err := gonanoid.Generate(referenceAlphabet, n)
+	if err != nil {
+		return "", err
+	}
+	return g.Prefix + body, nil
+}
+
+// TimeOrderedReferenceGenerator issues references that sort in issue order:
+// Prefix, the Lagos time to the millisecond, a per-millisecond sequence
+// number and random characters filling up to Length. A zero Length means
+// 30, the most SafeReferenceFormat allows, which leaves room for a prefix
+// of up to 6 characters.
+type TimeOrderedReferenceGenerator struct {
+	Prefix string
+	Length int
+
+	mu   sync.Mutex
+	last int64
+	seq  int
+}
+
+func (g *TimeOrderedReferenceGenerator) NewReference() (string, error) {
+	n, err := referenceBody(g.Prefix, g.Length, 30)
+	if err != nil {
+		return "", err
+	}
+	// 17 for the time and 3 for the sequence leave at least 4 random
+	// characters to tell generators in different processes apart
+	if n < 24 {
+		return "", fmt.Errorf("%w: time ordered references need 24 characters after prefix %q; shorten the prefix or raise Length and the ReferenceFormat", ErrInvalidArgument, g.Prefix)
+	}
+
+	g.mu.Lock()
+	now := time.Now().UnixMilli()
+	if now <= g.last {
+		g.seq++
+		// more than 46,655 references in a millisecond borrow the next one
+		if g.seq >= 36*36*36 {
+			g.last++
+			g.seq = 0
+		}
+	} else {
+		g.last, g.seq = now, 0
+	}
+	stamp, seq := g.last, g.seq
+	g.mu.Unlock()
+
+	random, err := gonanoid.Generate(referenceAlphabet, n-20)
+	if err != nil {
+		return "", err
+	}
+	sequence := strconv.FormatInt(int64(seq), 36)
+	return g.Prefix + time.UnixMilli(stamp).In(Lagos).Format("20060102150405") + fmt.Sprintf("%03d", stamp%1000) +
+		strings.Repeat("0", 3-len(sequence)) + sequence + random, nil
+}
+
+// KeyedReference derives a reference from a business key, such as an
+// invoice or payout ID, so retries of the same operation carry the same
+// reference. It is Prefix followed by a hash of key, length characters in
+// all; different keys collide with negligible probability at 15 or more.
+func KeyedReference(prefix, key string, length int) (string, error) {
+	n, err := referenceBody(prefix, length, 15)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(key))
+	encoded := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(sum[:]))
+	if n > len(encoded) {
+		return "", fmt.Errorf("%w: keyed references are at most %d characters after the prefix", ErrInvalidArgument, len(encoded))
+	}
+	return prefix + encoded[:n], nil
+}
+
+// referenceBody returns how many characters follow prefix in a reference
+// of length, or def when length is zero.
+func referenceBody(prefix string, length, def int) (int, error) {
+	if length <= 0 {
+		length = def
+	}
+	n := length - len(prefix)
+	if n < 8 {
+		return 0, fmt.Errorf("%w: reference length %d leaves fewer than 8 characters after prefix %q", ErrInvalidArgument, length, prefix)
+	}
+	return n, nil
+}
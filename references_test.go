@@ -0,0 +1,168 @@
+package spay
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestReferenceFormatValidate(t *testing.T) {
+	safe := SafeReferenceFormat()
+	tests := []struct {
+		name    string
+		format  ReferenceFormat
+		ref     string
+		wantErr bool
+	}{
+		{name: "safe nano id", format: safe, ref: "V1StGXR8_Z5jdHi6B-myT"},
+		{name: "safe 30 characters", format: safe, ref: strings.Repeat("a", 30)},
+		{name: "safe 31 characters", format: safe, ref: strings.Repeat("a", 31), wantErr: true},
+		{name: "safe uuid", format: safe, ref: "9b2f4c1e-8d3a-4f6b-a1c2-3e4d5f6a7b8c", wantErr: true},
+		{name: "safe space", format: safe, ref: "ACME 1", wantErr: true},
+		{name: "empty", format: safe, ref: "", wantErr: true},
+		{name: "length only", format: ReferenceFormat{MaxLength: 4}, ref: "a b!"},
+		{name: "pattern only", format: ReferenceFormat{Pattern: regexp.MustCompile(`^INV-\d+$`)}, ref: "INV-" + strings.Repeat("1", 60)},
+		{name: "pattern mismatch", format: ReferenceFormat{Pattern: regexp.MustCompile(`^INV-\d+$`)}, ref: "PO-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.format.Validate(tt.ref)
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, ErrInvalidArgument)) {
+				t.Errorf("Validate(%q) = %v, want error %v", tt.ref, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReferenceFormatIsOptIn(t *testing.T) {
+	uuid := "9b2f4c1e-8d3a-4f6b-a1c2-3e4d5f6a7b8c"
+	tests := []struct {
+		name     string
+		opts     []Option
+		wantSent bool
+	}{
+		{name: "unchecked by default", wantSent: true},
+		{name: "safe format", opts: []Option{WithReferenceFormat(SafeReferenceFormat())}},
+		{name: "format allowing uuids", opts: []Option{WithReferenceFormat(ReferenceFormat{MaxLength: 36})}, wantSent: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int64
+			api := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.Write([]byte(`{"response":"00","message":"ok"}`))
+			}, tt.opts...)
+			_, err := api.SterlingTransfer(&SterlingToSterlingTransferRequest{ReferenceId: uuid, ToAcct: "0000000002", Amt: 100})
+			if sent := calls.Load() == 1; sent != tt.wantSent {
+				t.Fatalf("sent %v, want %v (%v)", sent, tt.wantSent, err)
+			}
+			if !tt.wantSent && !errors.Is(err, ErrInvalidArgument) {
+				t.Errorf("got %v, want ErrInvalidArgument", err)
+			}
+		})
+	}
+}
+
+func TestReferenceGenerators(t *testing.T) {
+	safe := SafeReferenceFormat()
+	tests := []struct {
+		name    string
+		gen     ReferenceGenerator
+		wantLen int
+		prefix  string
+		wantErr bool
+	}{
+		{name: "random default", gen: RandomReferenceGenerator{}, wantLen: 15},
+		{name: "random prefix", gen: RandomReferenceGenerator{Prefix: "ACME", Length: 20}, wantLen: 20, prefix: "ACME"},
+		{name: "random too short", gen: RandomReferenceGenerator{Prefix: "ACME", Length: 10}, wantErr: true},
+		{name: "time ordered default", gen: &TimeOrderedReferenceGenerator{}, wantLen: 30},
+		{name: "time ordered prefix", gen: &TimeOrderedReferenceGenerator{Prefix: "PAYOUT"}, wantLen: 30, prefix: "PAYOUT"},
+		{name: "time ordered prefix too long", gen: &TimeOrderedReferenceGenerator{Prefix: "PAYOUTS"}, wantErr: true},
+		{name: "time ordered longer", gen: &TimeOrderedReferenceGenerator{Prefix: "PAYOUTS", Length: 32}, wantLen: 32, prefix: "PAYOUTS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, err := tt.gen.NewReference()
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidArgument) {
+					t.Fatalf("got %q, %v; want ErrInvalidArgument", ref, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ref) != tt.wantLen || !strings.HasPrefix(ref, tt.prefix) {
+				t.Errorf("reference %q, want %d characters starting %q", ref, tt.wantLen, tt.prefix)
+			}
+			if tt.wantLen <= 30 {
+				if err := safe.Validate(ref); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+}
+
+func TestTimeOrderedReferencesSortAndAreUnique(t *testing.T) {
+	gen := &TimeOrderedReferenceGenerator{}
+	var mu sync.Mutex
+	var refs []string
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				ref, err := gen.NewReference()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				refs = append(refs, ref)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		if seen[ref] {
+			t.Fatalf("reference %s issued twice", ref)
+		}
+		seen[ref] = true
+	}
+	// within one goroutine references come out in order
+	var last string
+	for i := 0; i < 100; i++ {
+		ref, _ := gen.NewReference()
+		// the first 20 characters are time and sequence
+		if ref[:20] <= last {
+			t.Fatalf("reference %s sorts before %s", ref, last)
+		}
+		last = ref[:20]
+	}
+}
+
+func TestKeyedReference(t *testing.T) {
+	a, err := KeyedReference("PO", "payout-42", 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := KeyedReference("PO", "payout-42", 20)
+	other, _ := KeyedReference("PO", "payout-43", 20)
+	if a != again || a == other || len(a) != 20 || !strings.HasPrefix(a, "PO") {
+		t.Errorf("KeyedReference: %q, again %q, other key %q", a, again, other)
+	}
+	for _, length := range []int{9, 60} {
+		if _, err := KeyedReference("PO", "payout-42", length); !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("length %d: got %v, want ErrInvalidArgument", length, err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package schedule
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/akacokafor/spay"
+)
+
+// Calendar decides which days transfers may run on.
+type Calendar interface {
+	IsBusinessDay(t time.Time) bool
+}
+
+// Holiday is a public holiday on Date, a day in Africa/Lagos.
+type Holiday struct {
+	Date time.Time
+	Name string
+}
+
+// NigerianHolidays is a Calendar of weekdays that are not Nigerian public
+// holidays. It knows the fixed-date holidays, with the Monday off when one
+// falls on a weekend, and Good Friday and Easter Monday. Eid and Maulud
+// follow the moon and are declared by the Federal Government each year, so
+// they have to be added as they are announced, as do one-off holidays.
+type NigerianHolidays struct {
+	mu    sync.RWMutex
+	extra map[string]string
+}
+
+var _ Calendar = (*NigerianHolidays)(nil)
+
+func NewNigerianHolidays(extra ...Holiday) *NigerianHolidays {
+	h := &NigerianHolidays{extra: map[string]string{}}
+	h.Add(extra...)
+	return h
+}
+
+// Add declares more holidays.
+func (h *NigerianHolidays) Add(holidays ...Holiday) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, holiday := range holidays {
+		h.extra[holiday.Date.In(spay.Lagos).Format(dateLayout)] = holiday.Name
+	}
+}
+
+// Holidays lists the holidays of year, in date order.
+func (h *NigerianHolidays) Holidays(year int) []Holiday {
+	date := func(m time.Month, d int) time.Time { return time.Date(year, m, d, 0, 0, 0, 0, spay.Lagos) }
+
+	democracyDay := date(time.June, 12)
+	if year < 2019 {
+		democracyDay = date(time.May, 29)
+	}
+	fixed := []Holiday{
+		{date(time.January, 1), "New Year's Day"},
+		{date(time.May, 1), "Workers' Day"},
+		{democracyDay, "Democracy Day"},
+		{date(time.October, 1), "Independence Day"},
+		{date(time.December, 25), "Christmas Day"},
+		{date(time.December, 26), "Boxing Day"},
+	}
+	easter := easterSunday(year)
+	out := []Holiday{
+		{easter.AddDate(0, 0, -2), "Good Friday"},
+		{easter.AddDate(0, 0, 1), "Easter Monday"},
+	}
+
+	taken := map[string]bool{}
+	for _, holiday := range append(append([]Holiday{}, fixed...), out...) {
+		taken[holiday.Date.Format(dateLayout)] = true
+	}
+	for _, holiday := range fixed {
+		out = append(out, holiday)
+		if !isWeekend(holiday.Date) {
+			continue
+		}
+		// the next free weekday is declared in lieu
+		day := holiday.Date
+		for isWeekend(day) || taken[day.Format(dateLayout)] {
+			day = day.AddDate(0, 0, 1)
+		}
+		taken[day.Format(dateLayout)] = true
+		out = append(out, Holiday{day, holiday.Name + " (observed)"})
+	}
+
+	h.mu.RLock()
+	for day, name := range h.extra {
+		if t, err := time.ParseInLocation(dateLayout, day, spay.Lagos); err == nil && t.Year() == year {
+			out = append(out, Holiday{t, name})
+		}
+	}
+	h.mu.RUnlock()
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Date.Before(out[j].Date) })
+	return out
+}
+
+func (h *NigerianHolidays) IsBusinessDay(t time.Time) bool {
+	t = t.In(spay.Lagos)
+	if isWeekend(t) {
+		return false
+	}
+	day := t.Format(dateLayout)
+	for _, holiday := range h.Holidays(t.Year()) {
+		if holiday.Date.Format(dateLayout) == day {
+			return false
+		}
+	}
+	return true
+}
+
+func isWeekend(t time.Time) bool {
+	return t.Weekday() == time.Saturday || t.Weekday() == time.Sunday
+}
+
+// easterSunday uses the anonymous Gregorian algorithm.
+func easterSunday(year int) time.Time {
+	a := year % 19
+	b, c := year/100, year%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, spay.Lagos)
+}
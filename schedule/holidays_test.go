@@ -0,0 +1,72 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/akacokafor/spay"
+)
+
+func day(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, spay.Lagos)
+}
+
+func TestIsBusinessDay(t *testing.T) {
+	cal := NewNigerianHolidays(Holiday{Date: day(2024, 4, 10), Name: "Eid al-Fitr"})
+	tests := []struct {
+		name string
+		date time.Time
+		want bool
+	}{
+		{name: "ordinary thursday", date: day(2024, 3, 28), want: true},
+		{name: "saturday", date: day(2024, 3, 30)},
+		{name: "sunday", date: day(2024, 3, 31)},
+		{name: "good friday", date: day(2024, 3, 29)},
+		{name: "easter monday", date: day(2024, 4, 1)},
+		{name: "added holiday", date: day(2024, 4, 10)},
+		{name: "added holiday is one day only", date: day(2024, 4, 11), want: true},
+		{name: "democracy day", date: day(2023, 6, 12)},
+		{name: "democracy day before 2019", date: day(2018, 5, 29)},
+		{name: "june 12 before 2019", date: day(2018, 6, 12), want: true},
+		{name: "boxing day after sunday christmas", date: day(2022, 12, 26)},
+		{name: "christmas observed after boxing day", date: day(2022, 12, 27)},
+		{name: "new year observed", date: day(2023, 1, 2)},
+		{name: "independence day", date: day(2024, 10, 1)},
+		{name: "late evening stays in lagos", date: time.Date(2024, 9, 30, 23, 30, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cal.IsBusinessDay(tt.date); got != tt.want {
+				t.Errorf("IsBusinessDay(%s) = %v, want %v", tt.date, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEasterSunday(t *testing.T) {
+	tests := []struct {
+		year int
+		want time.Time
+	}{
+		{2019, day(2019, 4, 21)},
+		{2020, day(2020, 4, 12)},
+		{2022, day(2022, 4, 17)},
+		{2024, day(2024, 3, 31)},
+		{2025, day(2025, 4, 20)},
+		{2038, day(2038, 4, 25)},
+	}
+	for _, tt := range tests {
+		if got := easterSunday(tt.year); !got.Equal(tt.want) {
+			t.Errorf("easterSunday(%d) = %s, want %s", tt.year, got.Format(dateLayout), tt.want.Format(dateLayout))
+		}
+	}
+}
+
+func TestHolidaysSorted(t *testing.T) {
+	holidays := NewNigerianHolidays().Holidays(2022)
+	for i := 1; i < len(holidays); i++ {
+		if holidays[i].Date.Before(holidays[i-1].Date) {
+			t.Fatalf("holidays out of order: %v before %v", holidays[i-1], holidays[i])
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akacokafor/spay"
+)
+
+// Rule produces the nominal times of a schedule's occurrences, before any
+// business day adjustment.
+type Rule interface {
+	// Next returns the first occurrence strictly after t, or the zero time
+	// when there is none.
+	Next(t time.Time) time.Time
+}
+
+// ParseRule parses a rule spec, evaluated in Africa/Lagos time:
+//
+//	daily 09:00
+//	weekly mon 08:30
+//	monthly 1 09:00      (days past the end of a month fall on its last day)
+//	monthly last 17:00
+//	0 9 1,15 * *         (five field cron: minute hour day month weekday)
+func ParseRule(spec string) (Rule, error) {
+	fields := strings.Fields(strings.ToLower(spec))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty schedule rule")
+	}
+	switch fields[0] {
+	case "daily", "weekly", "monthly":
+		return parseCalendar(fields)
+	}
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule rule %q: want a calendar rule or five cron fields", spec)
+	}
+	return parseCron(fields)
+}
+
+// calendarRule is a daily, weekly or monthly rule at a time of day.
+type calendarRule struct {
+	period       string
+	weekday      time.Weekday
+	day          int // 0 for the last day of the month
+	hour, minute int
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parseCalendar(fields []string) (Rule, error) {
+	want := map[string]int{"daily": 2, "weekly": 3, "monthly": 3}[fields[0]]
+	if len(fields) != want {
+		return nil, fmt.Errorf("schedule rule %q: want %d fields", strings.Join(fields, " "), want)
+	}
+	r := &calendarRule{period: fields[0]}
+	clock, err := time.Parse("15:04", fields[want-1])
+	if err != nil {
+		return nil, fmt.Errorf("schedule rule time %q: want HH:MM", fields[want-1])
+	}
+	r.hour, r.minute = clock.Hour(), clock.Minute()
+
+	switch r.period {
+	case "weekly":
+		name := fields[1]
+		if len(name) > 3 {
+			name = name[:3]
+		}
+		weekday, ok := weekdays[name]
+		if !ok {
+			return nil, fmt.Errorf("schedule rule weekday %q", fields[1])
+		}
+		r.weekday = weekday
+	case "monthly":
+		if fields[1] != "last" {
+			day, err := strconv.Atoi(fields[1])
+			if err != nil || day < 1 || day > 31 {
+				return nil, fmt.Errorf("schedule rule day %q: want 1-31 or last", fields[1])
+			}
+			r.day = day
+		}
+	}
+	return r, nil
+}
+
+func (r *calendarRule) Next(t time.Time) time.Time {
+	t = t.In(spay.Lagos)
+	y, m, d := t.Date()
+	switch r.period {
+	case "daily":
+		next := time.Date(y, m, d, r.hour, r.minute, 0, 0, spay.Lagos)
+		if !next.After(t) {
+			next = time.Date(y, m, d+1, r.hour, r.minute, 0, 0, spay.Lagos)
+		}
+		return next
+	case "weekly":
+		ahead := (int(r.weekday) - int(t.Weekday()) + 7) % 7
+		next := time.Date(y, m, d+ahead, r.hour, r.minute, 0, 0, spay.Lagos)
+		if !next.After(t) {
+			next = next.AddDate(0, 0, 7)
+		}
+		return next
+	default:
+		for i := 0; i < 2; i++ {
+			next := r.inMonth(y, m+time.Month(i))
+			if next.After(t) {
+				return next
+			}
+		}
+		return time.Time{}
+	}
+}
+
+func (r *calendarRule) inMonth(y int, m time.Month) time.Time {
+	last := time.Date(y, m+1, 0, 0, 0, 0, 0, spay.Lagos).Day()
+	day := r.day
+	if day == 0 || day > last {
+		day = last
+	}
+	return time.Date(y, m, day, r.hour, r.minute, 0, 0, spay.Lagos)
+}
+
+// cronRule is a standard five field cron expression. As in cron, when both
+// day of month and weekday are restricted a day matching either runs.
+type cronRule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+func parseCron(fields []string) (Rule, error) {
+	var r cronRule
+	var err error
+	if r.minute, err = cronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("cron minute: %w", err)
+	}
+	if r.hour, err = cronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("cron hour: %w", err)
+	}
+	if r.dom, err = cronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("cron day of month: %w", err)
+	}
+	if r.month, err = cronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("cron month: %w", err)
+	}
+	if r.dow, err = cronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("cron weekday: %w", err)
+	}
+	// 7 is Sunday too
+	if r.dow&(1<<7) != 0 {
+		r.dow |= 1
+	}
+	r.domAny, r.dowAny = fields[2] == "*", fields[4] == "*"
+	return &r, nil
+}
+
+// cronField parses a comma separated list of *, n, n-m and either with a
+// /step into a bit set.
+func cronField(field string, lo, hi int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+			part = part[:i]
+		}
+		from, to := lo, hi
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("bad value %q", part)
+			}
+			to = from
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("bad range %q", part)
+				}
+			} else if step > 1 {
+				to = hi
+			}
+		}
+		if from < lo || to > hi || from > to {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, lo, hi)
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (r *cronRule) dayMatches(t time.Time) bool {
+	if r.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	dom := r.dom&(1<<t.Day()) != 0
+	dow := r.dow&(1<<int(t.Weekday())) != 0
+	switch {
+	case r.domAny && r.dowAny:
+		return true
+	case r.domAny:
+		return dow
+	case r.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+func (r *cronRule) Next(t time.Time) time.Time {
+	t = t.In(spay.Lagos).Truncate(time.Minute).Add(time.Minute)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, spay.Lagos)
+	// five years covers every satisfiable expression, February 29 included
+	for i := 0; i < 5*366; i++ {
+		if r.dayMatches(day) {
+			for h := 0; h < 24; h++ {
+				if r.hour&(1<<h) == 0 {
+					continue
+				}
+				for m := 0; m < 60; m++ {
+					if r.minute&(1<<m) == 0 {
+						continue
+					}
+					next := time.Date(day.Year(), day.Month(), day.Day(), h, m, 0, 0, spay.Lagos)
+					if !next.Before(t) {
+						return next
+					}
+				}
+			}
+		}
+		day = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, spay.Lagos)
+	}
+	return time.Time{}
+}
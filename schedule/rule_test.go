@@ -0,0 +1,77 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/akacokafor/spay"
+)
+
+func at(y int, m time.Month, d, hour, minute int) time.Time {
+	return time.Date(y, m, d, hour, minute, 0, 0, spay.Lagos)
+}
+
+func TestRuleNext(t *testing.T) {
+	tests := []struct {
+		spec string
+		from time.Time
+		want []time.Time
+	}{
+		{spec: "daily 09:00", from: at(2024, 3, 4, 8, 0), want: []time.Time{at(2024, 3, 4, 9, 0), at(2024, 3, 5, 9, 0)}},
+		{spec: "daily 09:00", from: at(2024, 3, 4, 9, 0), want: []time.Time{at(2024, 3, 5, 9, 0)}},
+		{spec: "weekly mon 08:30", from: at(2024, 3, 6, 12, 0), want: []time.Time{at(2024, 3, 11, 8, 30), at(2024, 3, 18, 8, 30)}},
+		{spec: "weekly monday 08:30", from: at(2024, 3, 11, 8, 0), want: []time.Time{at(2024, 3, 11, 8, 30)}},
+		{spec: "monthly 31 09:00", from: at(2024, 1, 31, 10, 0), want: []time.Time{at(2024, 2, 29, 9, 0), at(2024, 3, 31, 9, 0), at(2024, 4, 30, 9, 0)}},
+		{spec: "monthly 1 09:00", from: at(2024, 12, 15, 0, 0), want: []time.Time{at(2025, 1, 1, 9, 0)}},
+		{spec: "monthly last 17:00", from: at(2023, 1, 31, 17, 0), want: []time.Time{at(2023, 2, 28, 17, 0), at(2023, 3, 31, 17, 0)}},
+		{spec: "0 9 1,15 * *", from: at(2024, 3, 1, 9, 0), want: []time.Time{at(2024, 3, 15, 9, 0), at(2024, 4, 1, 9, 0)}},
+		{spec: "*/15 * * * *", from: at(2024, 3, 4, 10, 7), want: []time.Time{at(2024, 3, 4, 10, 15), at(2024, 3, 4, 10, 30)}},
+		{spec: "30 8 * * 1-5", from: at(2024, 3, 8, 9, 0), want: []time.Time{at(2024, 3, 11, 8, 30)}},
+		{spec: "0 0 * * 7", from: at(2024, 3, 4, 0, 0), want: []time.Time{at(2024, 3, 10, 0, 0)}},
+		// day of month and weekday both restricted: either one runs
+		{spec: "0 12 13 * 5", from: at(2024, 3, 1, 12, 0), want: []time.Time{at(2024, 3, 8, 12, 0), at(2024, 3, 13, 12, 0), at(2024, 3, 15, 12, 0)}},
+		{spec: "0 0 29 2 *", from: at(2024, 3, 1, 0, 0), want: []time.Time{at(2028, 2, 29, 0, 0)}},
+		{spec: "0 0 31 2 *", from: at(2024, 3, 1, 0, 0), want: []time.Time{{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			rule, err := ParseRule(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			from := tt.from
+			for _, want := range tt.want {
+				got := rule.Next(from)
+				if !got.Equal(want) {
+					t.Fatalf("Next(%s) = %s, want %s", from, got, want)
+				}
+				from = got
+			}
+		})
+	}
+}
+
+func TestParseRuleErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"daily",
+		"daily 9am",
+		"daily 25:00",
+		"weekly funday 09:00",
+		"monthly 0 09:00",
+		"monthly 32 09:00",
+		"monthly first 09:00",
+		"0 9 * *",
+		"60 9 * * *",
+		"0 24 * * *",
+		"0 9 0 * *",
+		"0 9 * 13 *",
+		"0 9 * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+	} {
+		if _, err := ParseRule(spec); err == nil {
+			t.Errorf("ParseRule(%q): want an error", spec)
+		}
+	}
+}
@@ -0,0 +1,427 @@
+// Package schedule runs standing orders: recurring transfers defined by a
+// calendar or cron rule, moved off weekends and Nigerian public holidays.
+//
+//	s := schedule.New(api, schedule.NewMemoryStore(), schedule.Options{})
+//	err := s.Add(ctx, &schedule.Schedule{
+//		Rule:     "monthly 1 09:00",
+//		Adjust:   schedule.AdjustFollowing,
+//		Start:    time.Now(),
+//		Sterling: &spay.SterlingToSterlingTransferRequest{ToAcct: "0000000001", Amt: 250000, Remarks: "rent"},
+//	})
+//	go s.Run(ctx)
+//
+// An occurrence is sent until it succeeds, up to Options.MaxAttempts times
+// and only while each attempt was rejected or never sent. Its reference is
+// derived from the schedule and the occurrence, so every attempt carries
+// the same reference, and a run whose outcome is unknown is never resent
+// automatically.
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/akacokafor/spay"
+	"github.com/segmentio/ksuid"
+	"github.com/sirupsen/logrus"
+)
+
+const dateLayout = "2006-01-02"
+
+// Adjust says what happens to an occurrence that falls on a day that is
+// not a business day.
+type Adjust string
+
+const (
+	// AdjustNone runs on the day regardless.
+	AdjustNone Adjust = ""
+	// AdjustFollowing runs on the next business day.
+	AdjustFollowing Adjust = "following"
+	// AdjustPreceding runs on the previous business day.
+	AdjustPreceding Adjust = "preceding"
+)
+
+// Run statuses.
+const (
+	RunStatusRunning   = "running"
+	RunStatusSucceeded = "succeeded"
+	// RunStatusRejected means the transfer definitely did not go through;
+	// see spay.IsRejected.
+	RunStatusRejected = "rejected"
+	// RunStatusRetrying means the last attempt was rejected or never sent
+	// and another is due at NextAttempt.
+	RunStatusRetrying = "retrying"
+	// RunStatusUnknown means the transfer may or may not have gone through
+	// and needs a requery.
+	RunStatusUnknown = "unknown"
+)
+
+var (
+	ErrScheduleNotFound = errors.New("schedule not found")
+	// ErrRunExists is returned by Store.ClaimRun for an occurrence that has
+	// already been claimed.
+	ErrRunExists = errors.New("occurrence has already run")
+
+	// errNotSent marks failures before the transfer request went out.
+	errNotSent = errors.New("transfer not sent")
+)
+
+// Schedule is a recurring transfer. Exactly one of Sterling and Interbank
+// is set; an interbank transfer runs a fresh name enquiry every time, so
+// its session ID, NEResponse and BenefiName need not be filled in.
+type Schedule struct {
+	ID        string                                  `json:"id"`
+	Rule      string                                  `json:"rule"`
+	Adjust    Adjust                                  `json:"adjust,omitempty"`
+	Start     time.Time                               `json:"start"`
+	End       time.Time                               `json:"end,omitempty"`
+	Paused    bool                                    `json:"paused,omitempty"`
+	Sterling  *spay.SterlingToSterlingTransferRequest `json:"sterling,omitempty"`
+	Interbank *spay.InterBankTransferRequest          `json:"interbank,omitempty"`
+	// Through is the nominal time of the last occurrence materialised.
+	Through time.Time `json:"through,omitempty"`
+}
+
+// Occurrence is one instance of a schedule: Nominal is when the rule
+// places it and Due when it runs after business day adjustment.
+type Occurrence struct {
+	Nominal time.Time
+	Due     time.Time
+}
+
+// Run records one occurrence being sent. Attempts counts the sends made so
+// far, all under Reference.
+type Run struct {
+	ScheduleID  string          `json:"scheduleId"`
+	Occurrence  time.Time       `json:"occurrence"`
+	Due         time.Time       `json:"due"`
+	Reference   string          `json:"reference"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"nextAttempt,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	StartedAt   time.Time       `json:"startedAt"`
+	FinishedAt  time.Time       `json:"finishedAt,omitempty"`
+}
+
+// Store persists schedules and their runs. ClaimRun and RetryRun must be
+// atomic across every scheduler sharing the store. ClaimRun saves run and
+// fails with ErrRunExists when the schedule already has a run for
+// run.Occurrence. RetryRun saves run over a stored run that is still
+// RunStatusRetrying after run.Attempts-1 attempts, and fails with
+// ErrRunExists otherwise.
+type Store interface {
+	Save(ctx context.Context, schedule *Schedule) error
+	Get(ctx context.Context, id string) (*Schedule, error)
+	List(ctx context.Context) ([]*Schedule, error)
+	ClaimRun(ctx context.Context, run Run) error
+	RetryRun(ctx context.Context, run Run) error
+	FinishRun(ctx context.Context, run Run) error
+	Runs(ctx context.Context, scheduleID string) ([]Run, error)
+}
+
+type Options struct {
+	// Calendar defaults to NewNigerianHolidays().
+	Calendar Calendar
+	// PollInterval is how often Run looks for due occurrences; default 1m.
+	PollInterval time.Duration
+	// MaxAttempts caps the sends of an occurrence that keeps being
+	// rejected or failing before it is sent; default 3.
+	MaxAttempts int
+	// Backoff returns the wait after attempt n before the next; default
+	// doubles from 5m up to 2h.
+	Backoff func(attempts int) time.Duration
+}
+
+type Scheduler struct {
+	api   *spay.Api
+	store Store
+	opts  Options
+}
+
+func New(api *spay.Api, store Store, opts Options) *Scheduler {
+	if opts.Calendar == nil {
+		opts.Calendar = NewNigerianHolidays()
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Minute
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 3
+	}
+	if opts.Backoff == nil {
+		opts.Backoff = defaultBackoff
+	}
+	return &Scheduler{api: api, store: store, opts: opts}
+}
+
+func defaultBackoff(attempts int) time.Duration {
+	wait := 5 * time.Minute
+	for i := 1; i < attempts && wait < 2*time.Hour; i++ {
+		wait *= 2
+	}
+	if wait > 2*time.Hour {
+		wait = 2 * time.Hour
+	}
+	return wait
+}
+
+// Add validates schedule and stores it, assigning an ID when it has none.
+func (s *Scheduler) Add(ctx context.Context, schedule *Schedule) error {
+	if schedule.ID == "" {
+		schedule.ID = ksuid.New().String()
+	}
+	if (schedule.Sterling == nil) == (schedule.Interbank == nil) {
+		return fmt.Errorf("%w: a schedule needs exactly one transfer", spay.ErrInvalidArgument)
+	}
+	if _, err := ParseRule(schedule.Rule); err != nil {
+		return fmt.Errorf("%w: %v", spay.ErrInvalidArgument, err)
+	}
+	switch schedule.Adjust {
+	case AdjustNone, AdjustFollowing, AdjustPreceding:
+	default:
+		return fmt.Errorf("%w: adjust %q", spay.ErrInvalidArgument, schedule.Adjust)
+	}
+	if schedule.Start.IsZero() {
+		schedule.Start = time.Now()
+	}
+	return s.store.Save(ctx, schedule)
+}
+
+// Occurrences lists the occurrences of schedule due in [from, to).
+func (s *Scheduler) Occurrences(schedule *Schedule, from, to time.Time) ([]Occurrence, error) {
+	var out []Occurrence
+	// adjustment moves occurrences by up to a month, so look back that far
+	// for ones moved into the window
+	err := s.occurrences(schedule, from.AddDate(0, -1, 0), func(o Occurrence) bool {
+		if !o.Due.Before(to) {
+			return false
+		}
+		if !o.Due.Before(from) {
+			out = append(out, o)
+		}
+		return true
+	})
+	return out, err
+}
+
+// occurrences calls fn with each occurrence whose nominal time is after
+// cursor, in order, until fn returns false or the schedule ends.
+func (s *Scheduler) occurrences(schedule *Schedule, cursor time.Time, fn func(Occurrence) bool) error {
+	rule, err := ParseRule(schedule.Rule)
+	if err != nil {
+		return err
+	}
+	if start := schedule.Start.Add(-time.Nanosecond); cursor.Before(start) {
+		cursor = start
+	}
+	for {
+		nominal := rule.Next(cursor)
+		if nominal.IsZero() || (!schedule.End.IsZero() && nominal.After(schedule.End)) {
+			return nil
+		}
+		if !fn(Occurrence{Nominal: nominal, Due: s.adjust(nominal, schedule.Adjust)}) {
+			return nil
+		}
+		cursor = nominal
+	}
+}
+
+func (s *Scheduler) adjust(t time.Time, adjust Adjust) time.Time {
+	step := 0
+	switch adjust {
+	case AdjustFollowing:
+		step = 1
+	case AdjustPreceding:
+		step = -1
+	default:
+		return t
+	}
+	// a month of holidays in a row means the calendar is broken
+	for i := 0; i < 31 && !s.opts.Calendar.IsBusinessDay(t); i++ {
+		t = t.AddDate(0, 0, step)
+	}
+	return t
+}
+
+// Run sends due occurrences until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		if _, err := s.RunOnce(ctx, time.Now()); err != nil {
+			logrus.WithError(err).Error("schedule run failed")
+		}
+		// schedulers started by the same deploy would otherwise all list
+		// the store on the same tick
+		wait := s.opts.PollInterval + time.Duration(rand.Int63n(int64(s.opts.PollInterval)/4+1))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// RunOnce sends every occurrence due by now that has not run yet, retries
+// runs whose next attempt is due, and returns the runs it made.
+func (s *Scheduler) RunOnce(ctx context.Context, now time.Time) ([]Run, error) {
+	schedules, err := s.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []Run
+	var errs []error
+	for _, schedule := range schedules {
+		var due []Occurrence
+		err := s.occurrences(schedule, schedule.Through, func(o Occurrence) bool {
+			if o.Due.After(now) {
+				return false
+			}
+			due = append(due, o)
+			return true
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("schedule %s: %w", schedule.ID, err))
+			continue
+		}
+
+		if !schedule.Paused {
+			retried, err := s.retryDue(ctx, schedule, now)
+			runs = append(runs, retried...)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("schedule %s: %w", schedule.ID, err))
+			}
+		}
+
+		through := schedule.Through
+		for _, o := range due {
+			// occurrences missed while paused are skipped, not caught up
+			if !schedule.Paused {
+				run, err := s.runOccurrence(ctx, schedule, o, now)
+				if err != nil && !errors.Is(err, ErrRunExists) {
+					errs = append(errs, fmt.Errorf("schedule %s at %s: %w", schedule.ID, o.Nominal.Format(time.RFC3339), err))
+					break
+				}
+				if err == nil {
+					runs = append(runs, run)
+				}
+			}
+			through = o.Nominal
+		}
+		if !through.Equal(schedule.Through) {
+			schedule.Through = through
+			if err := s.store.Save(ctx, schedule); err != nil {
+				errs = append(errs, fmt.Errorf("schedule %s: %w", schedule.ID, err))
+			}
+		}
+	}
+	return runs, errors.Join(errs...)
+}
+
+// Reference derives the transfer reference of an occurrence. It is stable,
+// so a second attempt at the same occurrence carries the same reference.
+func Reference(scheduleID string, nominal time.Time) string {
+	// 15 characters with no prefix is always a valid length
+	ref, _ := spay.KeyedReference("", scheduleID+"|"+nominal.UTC().Format(time.RFC3339), 15)
+	return ref
+}
+
+func (s *Scheduler) runOccurrence(ctx context.Context, schedule *Schedule, o Occurrence, now time.Time) (Run, error) {
+	run := Run{
+		ScheduleID: schedule.ID,
+		Occurrence: o.Nominal,
+		Due:        o.Due,
+		Reference:  Reference(schedule.ID, o.Nominal),
+		Status:     RunStatusRunning,
+		Attempts:   1,
+		StartedAt:  time.Now().UTC(),
+	}
+	if err := s.store.ClaimRun(ctx, run); err != nil {
+		return run, err
+	}
+	return s.attempt(ctx, schedule, run, now)
+}
+
+// retryDue makes the next attempt of each run of schedule waiting to be
+// retried by now.
+func (s *Scheduler) retryDue(ctx context.Context, schedule *Schedule, now time.Time) ([]Run, error) {
+	stored, err := s.store.Runs(ctx, schedule.ID)
+	if err != nil {
+		return nil, err
+	}
+	var runs []Run
+	for _, run := range stored {
+		if run.Status != RunStatusRetrying || run.NextAttempt.After(now) {
+			continue
+		}
+		run.Status, run.Attempts, run.NextAttempt = RunStatusRunning, run.Attempts+1, time.Time{}
+		run.Error, run.StartedAt, run.FinishedAt = "", time.Now().UTC(), time.Time{}
+		if err := s.store.RetryRun(ctx, run); err != nil {
+			if errors.Is(err, ErrRunExists) {
+				continue
+			}
+			return runs, err
+		}
+		run, err := s.attempt(ctx, schedule, run, now)
+		if err != nil {
+			return runs, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// attempt sends a claimed run and stores its outcome. A rejected attempt
+// is due again Backoff after now, until MaxAttempts.
+func (s *Scheduler) attempt(ctx context.Context, schedule *Schedule, run Run, now time.Time) (Run, error) {
+	result, err := s.send(ctx, schedule, run.Reference)
+	run.FinishedAt = time.Now().UTC()
+	switch {
+	case err == nil:
+		run.Status = RunStatusSucceeded
+		run.Result, _ = json.Marshal(result)
+	case spay.IsRejected(err) || errors.Is(err, errNotSent):
+		run.Status, run.Error = RunStatusRejected, err.Error()
+		if run.Attempts < s.opts.MaxAttempts {
+			run.Status, run.NextAttempt = RunStatusRetrying, now.Add(s.opts.Backoff(run.Attempts))
+		}
+	default:
+		run.Status, run.Error = RunStatusUnknown, err.Error()
+	}
+
+	// a run left running is neither retried nor resent, so store the
+	// outcome even when ctx has ended
+	finishCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := s.store.FinishRun(finishCtx, run); err != nil {
+		return run, fmt.Errorf("recording run %s: %w", run.Reference, err)
+	}
+	return run, nil
+}
+
+func (s *Scheduler) send(ctx context.Context, schedule *Schedule, reference string) (any, error) {
+	if schedule.Sterling != nil {
+		req := *schedule.Sterling
+		req.ReferenceId = reference
+		return s.api.SterlingTransferContext(ctx, &req)
+	}
+
+	req := *schedule.Interbank
+	req.Reference = reference
+	if req.PaymentReference == "" {
+		req.PaymentReference = reference
+	}
+	enquiry, err := s.api.OtherBanksNameEnquiryContext(ctx, req.ToAccount, req.DestinationBankCode)
+	if err != nil {
+		return nil, fmt.Errorf("%w: name enquiry: %w", errNotSent, err)
+	}
+	req.NameEnquirySessionID = enquiry.SessionID
+	req.NEResponse = enquiry.AccountName
+	req.BenefiName = enquiry.AccountName
+	return s.api.InitiateInterBankTransferContext(ctx, &req)
+}
@@ -0,0 +1,118 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-process Store.
+type MemoryStore struct {
+	mu        sync.Mutex
+	schedules map[string][]byte
+	runs      map[string][]Run
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{schedules: map[string][]byte{}, runs: map[string][]Run{}}
+}
+
+// schedules are stored as JSON, so a Schedule passed to Save or returned by
+// Get can be changed without touching the stored copy.
+
+func (m *MemoryStore) Save(_ context.Context, schedule *Schedule) error {
+	data, err := json.Marshal(schedule)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.schedules[schedule.ID] = data
+	return nil
+}
+
+func (m *MemoryStore) Get(_ context.Context, id string) (*Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.load(id)
+}
+
+func (m *MemoryStore) List(_ context.Context) ([]*Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]*Schedule, 0, len(m.schedules))
+	for id := range m.schedules {
+		schedule, err := m.load(id)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, schedule)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (m *MemoryStore) load(id string) (*Schedule, error) {
+	data, ok := m.schedules[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrScheduleNotFound, id)
+	}
+	var schedule Schedule
+	if err := json.Unmarshal(data, &schedule); err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+func (m *MemoryStore) ClaimRun(_ context.Context, run Run) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, i := m.find(run.ScheduleID, run.Occurrence); i >= 0 {
+		return fmt.Errorf("%w: %s", ErrRunExists, run.Reference)
+	}
+	m.runs[run.ScheduleID] = append(m.runs[run.ScheduleID], run)
+	return nil
+}
+
+func (m *MemoryStore) RetryRun(_ context.Context, run Run) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	runs, i := m.find(run.ScheduleID, run.Occurrence)
+	if i < 0 || runs[i].Status != RunStatusRetrying || runs[i].Attempts != run.Attempts-1 {
+		return fmt.Errorf("%w: %s attempt %d", ErrRunExists, run.Reference, run.Attempts)
+	}
+	runs[i] = run
+	return nil
+}
+
+func (m *MemoryStore) FinishRun(_ context.Context, run Run) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	runs, i := m.find(run.ScheduleID, run.Occurrence)
+	if i < 0 {
+		return fmt.Errorf("run %s was never claimed", run.Reference)
+	}
+	runs[i] = run
+	return nil
+}
+
+func (m *MemoryStore) Runs(_ context.Context, scheduleID string) ([]Run, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Run(nil), m.runs[scheduleID]...), nil
+}
+
+func (m *MemoryStore) find(scheduleID string, occurrence time.Time) ([]Run, int) {
+	runs := m.runs[scheduleID]
+	for i, run := range runs {
+		if run.Occurrence.Equal(occurrence) {
+			return runs, i
+		}
+	}
+	return runs, -1
+}
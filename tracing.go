@@ -0,0 +1,73 @@
+package spay
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/akacokafor/spay"
+
+// Span attribute keys. Only identifiers and codes are recorded; account
+// numbers, names, amounts and payloads never are.
+const (
+	attrOperation    = attribute.Key("spay.operation")
+	attrRequestType  = attribute.Key("spay.request_type")
+	attrReference    = attribute.Key("spay.reference")
+	attrResponseCode = attribute.Key("spay.response_code")
+	attrHttpStatus   = attribute.Key("http.status_code")
+)
+
+// WithTracerProvider records spans with tp instead of the global
+// OpenTelemetry tracer provider.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(a *Api) {
+		if tp != nil {
+			a.tracer = tp.Tracer(tracerName)
+		}
+	}
+}
+
+// startOperation starts the span wrapping a public Api method.
+func (a *Api) startOperation(ctx context.Context, op operation, reference string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{attrOperation.String(op.name)}
+	if op.requestType != 0 {
+		attrs = append(attrs, attrRequestType.Int(op.requestType))
+	}
+	if reference != "" {
+		attrs = append(attrs, attrReference.String(reference))
+	}
+	return a.tracer.Start(ctx, "spay."+op.name, trace.WithAttributes(attrs...))
+}
+
+// observeResponse records a Spay response code on both the span and the
+// metrics, whether it came with a 2xx or an error response.
+func (a *Api) observeResponse(span trace.Span, op operation, code string) {
+	span.SetAttributes(attrResponseCode.String(code))
+	a.metrics.ObserveResponseCode(op.name, code)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// propagatingTransport injects the trace context of each request into its
+// headers so Sterling-side or proxy spans can join the caller's trace.
+type propagatingTransport struct {
+	base http.RoundTripper
+}
+
+func (t propagatingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	otel.GetTextMapPropagator().Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+	return t.base.RoundTrip(req)
+}
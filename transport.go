@@ -0,0 +1,161 @@
+package spay
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// TransportConfig configures the HTTP client every network method uses.
+// Zero durations and sizes take the values of DefaultTransportConfig.
+type TransportConfig struct {
+	// Timeout bounds a whole exchange including reading the body. Context
+	// deadlines still apply on top of it.
+	Timeout               time.Duration
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+
+	KeepAlive           time.Duration
+	IdleConnTimeout     time.Duration
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost of zero leaves connections per host unlimited.
+	MaxConnsPerHost int
+
+	// RootCAs verifies Sterling's certificates; nil uses the system pool.
+	RootCAs *x509.CertPool
+	// ClientCertificates are presented for mutual TLS.
+	ClientCertificates []tls.Certificate
+	// MinTLSVersion defaults to TLS 1.2.
+	MinTLSVersion uint16
+
+	// Proxy selects an outbound proxy per request; nil uses the
+	// HTTPS_PROXY/NO_PROXY environment. ProxyURL is a shorthand for a fixed
+	// proxy and takes precedence.
+	Proxy    func(*http.Request) (*url.URL, error)
+	ProxyURL *url.URL
+}
+
+// DefaultTransportConfig is what NewApi uses without WithTransport.
+func DefaultTransportConfig() TransportConfig {
+	return TransportConfig{
+		Timeout:               90 * time.Second,
+		DialTimeout:           10 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 60 * time.Second,
+		KeepAlive:             30 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		MinTLSVersion:         tls.VersionTLS12,
+	}
+}
+
+func (c TransportConfig) withDefaults() TransportConfig {
+	d := DefaultTransportConfig()
+	if c.Timeout <= 0 {
+		c.Timeout = d.Timeout
+	}
+	if c.DialTimeout <= 0 {
+		c.DialTimeout = d.DialTimeout
+	}
+	if c.TLSHandshakeTimeout <= 0 {
+		c.TLSHandshakeTimeout = d.TLSHandshakeTimeout
+	}
+	if c.ResponseHeaderTimeout <= 0 {
+		c.ResponseHeaderTimeout = d.ResponseHeaderTimeout
+	}
+	if c.KeepAlive <= 0 {
+		c.KeepAlive = d.KeepAlive
+	}
+	if c.IdleConnTimeout <= 0 {
+		c.IdleConnTimeout = d.IdleConnTimeout
+	}
+	if c.MaxIdleConns <= 0 {
+		c.MaxIdleConns = d.MaxIdleConns
+	}
+	if c.MaxIdleConnsPerHost <= 0 {
+		c.MaxIdleConnsPerHost = d.MaxIdleConnsPerHost
+	}
+	if c.MinTLSVersion == 0 {
+		c.MinTLSVersion = d.MinTLSVersion
+	}
+	return c
+}
+
+func newHttpClient(cfg TransportConfig) *http.Client {
+	cfg = cfg.withDefaults()
+
+	proxy := cfg.Proxy
+	if cfg.ProxyURL != nil {
+		proxy = http.ProxyURL(cfg.ProxyURL)
+	}
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+
+	dialer := &net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: cfg.KeepAlive}
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig: &tls.Config{
+			RootCAs:      cfg.RootCAs,
+			Certificates: cfg.ClientCertificates,
+			MinVersion:   cfg.MinTLSVersion,
+		},
+	}
+
+	return &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: propagatingTransport{base: transport},
+	}
+}
+
+// WithTransport replaces the default HTTP client settings.
+func WithTransport(cfg TransportConfig) Option {
+	return func(a *Api) {
+		a.httpClient = newHttpClient(cfg)
+	}
+}
+
+// LoadCertPool returns the system pool with the PEM certificates in files
+// added, for Sterling endpoints signed by a private CA.
+func LoadCertPool(files ...string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("ca file: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("ca file %s: no PEM certificates found", file)
+		}
+	}
+	return pool, nil
+}
+
+// LoadClientCertificate reads a PEM certificate and key pair for mutual TLS.
+func LoadClientCertificate(certFile, keyFile string) (tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("client certificate: %w", err)
+	}
+	return cert, nil
+}
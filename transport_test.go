@@ -0,0 +1,120 @@
+package spay
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func baseTransport(t *testing.T, client *http.Client) *http.Transport {
+	t.Helper()
+	transport, ok := client.Transport.(propagatingTransport).base.(*http.Transport)
+	if !ok {
+		t.Fatalf("transport %T, want an *http.Transport", client.Transport)
+	}
+	return transport
+}
+
+func TestTransportDefaults(t *testing.T) {
+	client := newHttpClient(TransportConfig{DialTimeout: 3 * time.Second, MaxConnsPerHost: 4})
+	transport := baseTransport(t, client)
+	d := DefaultTransportConfig()
+
+	if client.Timeout != d.Timeout {
+		t.Errorf("timeout %s, want the default %s", client.Timeout, d.Timeout)
+	}
+	if transport.TLSHandshakeTimeout != d.TLSHandshakeTimeout || transport.ResponseHeaderTimeout != d.ResponseHeaderTimeout ||
+		transport.MaxIdleConnsPerHost != d.MaxIdleConnsPerHost || transport.TLSClientConfig.MinVersion != tls.VersionTLS12 {
+		t.Errorf("transport %+v does not carry the defaults", transport)
+	}
+	if transport.MaxConnsPerHost != 4 {
+		t.Errorf("MaxConnsPerHost %d, want the configured 4", transport.MaxConnsPerHost)
+	}
+	if cfg := (TransportConfig{DialTimeout: 3 * time.Second}).withDefaults(); cfg.DialTimeout != 3*time.Second || cfg.KeepAlive != d.KeepAlive {
+		t.Errorf("withDefaults = %+v, want the dial timeout kept and the rest defaulted", cfg)
+	}
+}
+
+func TestTransportProxy(t *testing.T) {
+	fixed, _ := url.Parse("http://fixed.proxy:3128")
+	chosen, _ := url.Parse("http://chosen.proxy:3128")
+	choose := func(*http.Request) (*url.URL, error) { return chosen, nil }
+	req, _ := http.NewRequest(http.MethodPost, "https://spay.example/api", nil)
+
+	tests := []struct {
+		name string
+		cfg  TransportConfig
+		want *url.URL
+	}{
+		{name: "func", cfg: TransportConfig{Proxy: choose}, want: chosen},
+		{name: "url wins", cfg: TransportConfig{Proxy: choose, ProxyURL: fixed}, want: fixed},
+	}
+	for _, tt := range tests {
+		got, err := baseTransport(t, newHttpClient(tt.cfg)).Proxy(req)
+		if err != nil || got.String() != tt.want.String() {
+			t.Errorf("%s: proxy %v, %v; want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestTransportTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	junkFile := filepath.Join(dir, "junk.pem")
+	if err := os.WriteFile(junkFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	pool, err := LoadCertPool(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCertPool(junkFile); err == nil {
+		t.Error("LoadCertPool of a file without certificates: want an error")
+	}
+	if _, err := LoadCertPool(filepath.Join(dir, "missing.pem")); err == nil {
+		t.Error("LoadCertPool of a missing file: want an error")
+	}
+
+	trusting := newHttpClient(TransportConfig{RootCAs: pool})
+	if resp, err := trusting.Get(srv.URL); err != nil {
+		t.Errorf("with the CA: %v", err)
+	} else {
+		resp.Body.Close()
+	}
+	if resp, err := newHttpClient(TransportConfig{}).Get(srv.URL); err == nil {
+		resp.Body.Close()
+		t.Error("without the CA: want a certificate error")
+	}
+}
+
+func TestTransportResponseHeaderTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := newHttpClient(TransportConfig{ResponseHeaderTimeout: 10 * time.Millisecond})
+	start := time.Now()
+	resp, err := client.Get(srv.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("want a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 80*time.Millisecond {
+		t.Errorf("gave up after %s, want about 10ms", elapsed)
+	}
+}
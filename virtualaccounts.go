@@ -0,0 +1,136 @@
+package spay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrVirtualAccountNotFound = errors.New("virtual account not found")
+
+// VirtualAccount is a Sterling collection account assigned to one customer.
+type VirtualAccount struct {
+	AccountNumber string    `json:"accountNumber"`
+	CustomerID    string    `json:"customerId"`
+	Name          string    `json:"name,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// VirtualAccountStore maps virtual accounts to customers so inflows can be
+// attributed by the account they were credited to rather than by Remark
+// text. Spay has no request type for issuing virtual or collection
+// accounts; Sterling creates them out of band and they are recorded here.
+// Save fails when the account is already assigned to another customer.
+type VirtualAccountStore interface {
+	Save(ctx context.Context, account VirtualAccount) error
+	Get(ctx context.Context, accountNumber string) (VirtualAccount, error)
+	ListByCustomer(ctx context.Context, customerID string) ([]VirtualAccount, error)
+}
+
+// AttributedInflow is an Inflow with the customer owning the account it was
+// credited to. CustomerID is empty when the account is not a known virtual
+// account.
+type AttributedInflow struct {
+	Inflow
+	CustomerID     string
+	VirtualAccount *VirtualAccount
+}
+
+// AttributeInflows looks up the owner of every inflow's account in store.
+func AttributeInflows(ctx context.Context, store VirtualAccountStore, inflows []Inflow) ([]AttributedInflow, error) {
+	out := make([]AttributedInflow, 0, len(inflows))
+	owners := map[string]*VirtualAccount{}
+	for _, inflow := range inflows {
+		owner, seen := owners[inflow.AccountNumber]
+		if !seen {
+			account, err := store.Get(ctx, inflow.AccountNumber)
+			switch {
+			case err == nil:
+				owner = &account
+			case !errors.Is(err, ErrVirtualAccountNotFound):
+				return nil, fmt.Errorf("virtual account %s: %w", inflow.AccountNumber, err)
+			}
+			owners[inflow.AccountNumber] = owner
+		}
+
+		attributed := AttributedInflow{Inflow: inflow, VirtualAccount: owner}
+		if owner != nil {
+			attributed.CustomerID = owner.CustomerID
+		}
+		out = append(out, attributed)
+	}
+	return out, nil
+}
+
+func (a *Api) ListAttributedInflowsForToday(store VirtualAccountStore, accountNumber string, banks ListOfBankResponse) ([]AttributedInflow, error) {
+	return a.ListAttributedInflowsForTodayContext(context.Background(), store, accountNumber, banks)
+}
+
+// ListAttributedInflowsForTodayContext lists today's inflows credited to
+// accountNumber and attributes them to customers. Sender banks are resolved
+// against banks; with nil banks they keep the name Sterling sent.
+func (a *Api) ListAttributedInflowsForTodayContext(ctx context.Context, store VirtualAccountStore, accountNumber string, banks ListOfBankResponse) ([]AttributedInflow, error) {
+	result, err := a.ListInflowsForTodayForAccountIDContext(ctx, accountNumber)
+	if err != nil {
+		return nil, err
+	}
+	inflows, err := result.Inflows(banks)
+	if err != nil {
+		return nil, err
+	}
+	return AttributeInflows(ctx, store, inflows)
+}
+
+// MemoryVirtualAccountStore is an in-process VirtualAccountStore.
+type MemoryVirtualAccountStore struct {
+	mu       sync.Mutex
+	accounts map[string]VirtualAccount
+}
+
+var _ VirtualAccountStore = (*MemoryVirtualAccountStore)(nil)
+
+func NewMemoryVirtualAccountStore() *MemoryVirtualAccountStore {
+	return &MemoryVirtualAccountStore{accounts: map[string]VirtualAccount{}}
+}
+
+func (s *MemoryVirtualAccountStore) Save(_ context.Context, account VirtualAccount) error {
+	if account.AccountNumber == "" || account.CustomerID == "" {
+		return fmt.Errorf("%w: account number and customer id are required", ErrInvalidArgument)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.accounts[account.AccountNumber]; ok && existing.CustomerID != account.CustomerID {
+		return fmt.Errorf("virtual account %s already belongs to customer %s", account.AccountNumber, existing.CustomerID)
+	}
+	if account.CreatedAt.IsZero() {
+		account.CreatedAt = time.Now().UTC()
+	}
+	s.accounts[account.AccountNumber] = account
+	return nil
+}
+
+func (s *MemoryVirtualAccountStore) Get(_ context.Context, accountNumber string) (VirtualAccount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account, ok := s.accounts[accountNumber]
+	if !ok {
+		return VirtualAccount{}, fmt.Errorf("%w: %s", ErrVirtualAccountNotFound, accountNumber)
+	}
+	return account, nil
+}
+
+func (s *MemoryVirtualAccountStore) ListByCustomer(_ context.Context, customerID string) ([]VirtualAccount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []VirtualAccount
+	for _, account := range s.accounts {
+		if account.CustomerID == customerID {
+			out = append(out, account)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].AccountNumber < out[j].AccountNumber })
+	return out, nil
+}
@@ -0,0 +1,157 @@
+package spay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// countingStore counts lookups and fails those for account broken.
+type countingStore struct {
+	*MemoryVirtualAccountStore
+	gets   map[string]int
+	broken string
+}
+
+func (s *countingStore) Get(ctx context.Context, accountNumber string) (VirtualAccount, error) {
+	s.gets[accountNumber]++
+	if accountNumber == s.broken {
+		return VirtualAccount{}, errors.New("database down")
+	}
+	return s.MemoryVirtualAccountStore.Get(ctx, accountNumber)
+}
+
+func newCountingStore(t *testing.T, accounts ...VirtualAccount) *countingStore {
+	t.Helper()
+	store := &countingStore{MemoryVirtualAccountStore: NewMemoryVirtualAccountStore(), gets: map[string]int{}}
+	for _, account := range accounts {
+		if err := store.Save(context.Background(), account); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func TestAttributeInflows(t *testing.T) {
+	ctx := context.Background()
+	store := newCountingStore(t,
+		VirtualAccount{AccountNumber: "9000000001", CustomerID: "alice"},
+		VirtualAccount{AccountNumber: "9000000002", CustomerID: "bob"},
+	)
+	inflows := []Inflow{
+		{AccountNumber: "9000000001", SessionID: "s1"},
+		{AccountNumber: "9000000002", SessionID: "s2"},
+		{AccountNumber: "9000000001", SessionID: "s3"},
+		{AccountNumber: "9000000003", SessionID: "s4"},
+	}
+	attributed, err := AttributeInflows(ctx, store, inflows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var customers []string
+	for _, inflow := range attributed {
+		customers = append(customers, inflow.CustomerID)
+		if (inflow.VirtualAccount == nil) != (inflow.CustomerID == "") {
+			t.Errorf("%s: customer %q with account %+v", inflow.SessionID, inflow.CustomerID, inflow.VirtualAccount)
+		}
+	}
+	if want := []string{"alice", "bob", "alice", ""}; !reflect.DeepEqual(customers, want) {
+		t.Errorf("customers %q, want %q", customers, want)
+	}
+	if want := map[string]int{"9000000001": 1, "9000000002": 1, "9000000003": 1}; !reflect.DeepEqual(store.gets, want) {
+		t.Errorf("lookups %v, want one per account %v", store.gets, want)
+	}
+
+	store.broken = "9000000002"
+	store.gets = map[string]int{}
+	if _, err := AttributeInflows(ctx, store, inflows); err == nil || errors.Is(err, ErrVirtualAccountNotFound) {
+		t.Errorf("store failure: got %v, want the store's error", err)
+	}
+}
+
+func TestMemoryVirtualAccountStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryVirtualAccountStore()
+	for _, account := range []VirtualAccount{
+		{AccountNumber: "9000000002", CustomerID: "alice"},
+		{AccountNumber: "9000000001", CustomerID: "alice"},
+		{AccountNumber: "9000000003", CustomerID: "bob"},
+	} {
+		if err := store.Save(ctx, account); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.Save(ctx, VirtualAccount{AccountNumber: "9000000001", CustomerID: "alice", Name: "Alice Ltd"}); err != nil {
+		t.Errorf("saving an account again for its owner: %v", err)
+	}
+	if err := store.Save(ctx, VirtualAccount{AccountNumber: "9000000001", CustomerID: "bob"}); err == nil {
+		t.Error("reassigning an account to another customer: want an error")
+	}
+	if err := store.Save(ctx, VirtualAccount{AccountNumber: "9000000004"}); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("saving without a customer: got %v, want ErrInvalidArgument", err)
+	}
+
+	account, err := store.Get(ctx, "9000000001")
+	if err != nil || account.CustomerID != "alice" || account.Name != "Alice Ltd" || account.CreatedAt.IsZero() {
+		t.Errorf("Get = %+v, %v", account, err)
+	}
+	if _, err := store.Get(ctx, "9000000009"); !errors.Is(err, ErrVirtualAccountNotFound) {
+		t.Errorf("Get of an unknown account: got %v, want ErrVirtualAccountNotFound", err)
+	}
+
+	accounts, err := store.ListByCustomer(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var numbers []string
+	for _, account := range accounts {
+		numbers = append(numbers, account.AccountNumber)
+	}
+	if want := []string{"9000000001", "9000000002"}; !reflect.DeepEqual(numbers, want) {
+		t.Errorf("ListByCustomer = %v, want %v", numbers, want)
+	}
+}
+
+func TestListAttributedInflowsForToday(t *testing.T) {
+	store := newCountingStore(t, VirtualAccount{AccountNumber: "9000000001", CustomerID: "alice"})
+	api := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ListInflowForAccountResponse{Content: []InflowForAccountItem{
+			{AccountNumber: "9000000001", Amount: "1,000.00", Dateposted: "2024-03-04T10:00:00", SenderBank: "000013", SessionID: "s1"},
+			{AccountNumber: "9000000002", Amount: "50", Dateposted: "2024-03-04T11:00:00", SenderBank: "GTBank", SessionID: "s2"},
+		}})
+	})
+	banks := ListOfBankResponse{{BankName: "GTBank", BankCode: "000013"}}
+
+	tests := []struct {
+		name      string
+		banks     ListOfBankResponse
+		wantBanks []BankResponse
+	}{
+		{name: "banks resolved", banks: banks, wantBanks: []BankResponse{banks[0], banks[0]}},
+		{name: "no bank list", wantBanks: []BankResponse{{BankName: "000013"}, {BankName: "GTBank"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attributed, err := api.ListAttributedInflowsForToday(store, "9000000001", tt.banks)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var customers []string
+			var senders []BankResponse
+			for _, inflow := range attributed {
+				customers = append(customers, inflow.CustomerID)
+				senders = append(senders, inflow.SenderBank)
+			}
+			if want := []string{"alice", ""}; !reflect.DeepEqual(customers, want) {
+				t.Errorf("customers %q, want %q", customers, want)
+			}
+			if !reflect.DeepEqual(senders, tt.wantBanks) {
+				t.Errorf("sender banks %v, want %v", senders, tt.wantBanks)
+			}
+		})
+	}
+}